@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/disintegration/imaging"
+)
+
+const defaultDashLength = 8
+
+// borderPainter returns the colour of the border pixel at (x, y) on a canvas
+// of the given width and height
+type borderPainter func(x, y, width, height int) color.NRGBA
+
+// solidBorderStyle wraps a plain hex colour into a border style
+func solidBorderStyle(hex string) config.BorderStyle {
+	return config.BorderStyle{
+		Name:   "Solid",
+		Kind:   config.BorderSolid,
+		Colors: []string{hex},
+	}
+}
+
+// newBorderPainter validates a border style and returns the painter for it.
+// opaque is set for output without an alpha channel, such as JPEG, where
+// transparent gaps would come out black.
+func newBorderPainter(style config.BorderStyle, borderWidth int, opaque bool) (borderPainter, error) {
+	if len(style.Colors) == 0 {
+		return nil, fmt.Errorf("border style %q has no colors", style.Name)
+	}
+
+	colors := make([]color.NRGBA, 0, len(style.Colors))
+	for _, hex := range style.Colors {
+		c, err := hexToRGBA(hex)
+		if err != nil {
+			return nil, fmt.Errorf("border style %q: %v", style.Name, err)
+		}
+		colors = append(colors, color.NRGBA(c))
+	}
+
+	// Dashed and double borders leave their gaps transparent unless a second
+	// colour is given, or fill them with the line colour if the output
+	// cannot be transparent
+	gap := color.NRGBA{}
+	if len(colors) > 1 {
+		gap = colors[1]
+	} else if opaque {
+		gap = colors[0]
+	}
+
+	switch style.Kind {
+	case config.BorderSolid, "":
+		return func(_, _, _, _ int) color.NRGBA {
+			return colors[0]
+		}, nil
+
+	case config.BorderLinearGradient:
+		angle := style.Angle * math.Pi / 180
+		dx, dy := math.Cos(angle), math.Sin(angle)
+		return func(x, y, width, height int) color.NRGBA {
+			halfExtent := (math.Abs(float64(width)*dx) + math.Abs(float64(height)*dy)) / 2
+			if halfExtent == 0 {
+				return colors[0]
+			}
+			px := float64(x) - float64(width-1)/2
+			py := float64(y) - float64(height-1)/2
+			t := ((px*dx+py*dy)/halfExtent + 1) / 2
+			return gradientAt(colors, t)
+		}, nil
+
+	case config.BorderRadialGradient:
+		return func(x, y, width, height int) color.NRGBA {
+			cx, cy := float64(width-1)/2, float64(height-1)/2
+			maxDist := math.Hypot(cx, cy)
+			if maxDist == 0 {
+				return colors[0]
+			}
+			return gradientAt(colors, math.Hypot(float64(x)-cx, float64(y)-cy)/maxDist)
+		}, nil
+
+	case config.BorderDashed:
+		dash := style.DashLength
+		if dash <= 0 {
+			dash = defaultDashLength
+		}
+		return func(x, y, _, height int) color.NRGBA {
+			// Measure along the band the pixel belongs to, so the dashes run
+			// around the image instead of across it
+			pos := y
+			if y < borderWidth || y >= height-borderWidth {
+				pos = x
+			}
+			if (pos/dash)%2 == 0 {
+				return colors[0]
+			}
+			return gap
+		}, nil
+
+	case config.BorderDouble:
+		line := borderWidth / 3
+		if line < 1 {
+			line = 1
+		}
+		return func(x, y, width, height int) color.NRGBA {
+			edge := min(x, y, width-1-x, height-1-y)
+			if edge < line || edge >= borderWidth-line {
+				return colors[0]
+			}
+			return gap
+		}, nil
+	}
+
+	return nil, fmt.Errorf("border style %q has unknown kind %q", style.Name, style.Kind)
+}
+
+// gradientAt interpolates between evenly spaced colour stops at position t in [0, 1]
+func gradientAt(stops []color.NRGBA, t float64) color.NRGBA {
+	if len(stops) == 1 {
+		return stops[0]
+	}
+	t = math.Max(0, math.Min(1, t))
+
+	scaled := t * float64(len(stops)-1)
+	i := int(scaled)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	frac := scaled - float64(i)
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*frac))
+	}
+	from, to := stops[i], stops[i+1]
+	return color.NRGBA{
+		R: lerp(from.R, to.R),
+		G: lerp(from.G, to.G),
+		B: lerp(from.B, to.B),
+		A: lerp(from.A, to.A),
+	}
+}
+
+// addBorder adds a border painted by the given painter around an image
+func addBorder(img image.Image, borderWidth int, paint borderPainter) *image.NRGBA {
+	bounds := img.Bounds()
+	newWidth := bounds.Dx() + (borderWidth * 2)
+	newHeight := bounds.Dy() + (borderWidth * 2)
+
+	bordered := image.NewNRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			if x >= borderWidth && x < newWidth-borderWidth && y >= borderWidth && y < newHeight-borderWidth {
+				continue
+			}
+			bordered.SetNRGBA(x, y, paint(x, y, newWidth, newHeight))
+		}
+	}
+
+	// Draw the original image in the center
+	bordered = imaging.Paste(bordered, img, image.Point{borderWidth, borderWidth})
+
+	return bordered
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// runSubcommand handles the non-interactive commands given on the command
+// line and returns the process exit code
+func runSubcommand(args []string) int {
+	switch args[0] {
+	case "prepare":
+		return prepareCmd(args[1:])
+	case "run":
+		return runCmd(args[1:])
+	case "serve":
+		return serveCmd(args[1:])
+	case "gallery":
+		return galleryCmd(args[1:])
+	case "export-profile":
+		return exportProfileCmd(args[1:])
+	case "import-profile":
+		return importProfileCmd(args[1:])
+	case "export-companion":
+		return exportCompanionCmd(args[1:])
+	case "export-openstage":
+		return openStageExporter.run(args[1:])
+	case "export-touchosc":
+		return touchOSCExporter.run(args[1:])
+	case "export-template":
+		return exportTemplateCmd(args[1:])
+	case "export-csv":
+		return exportCSVCmd(args[1:])
+	case "import-csv":
+		return importCSVCmd(args[1:])
+	case "layout":
+		return layoutCmd(args[1:])
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck                          start the interactive tool")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck prepare [flags] <folder>")
+	fmt.Fprintln(w, "                                                      prepare a media folder without the wizard")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck run [flags] <config> <entry>")
+	fmt.Fprintln(w, "                                                      run the actions of an entry")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck serve [flags] <config>...")
+	fmt.Fprintln(w, "                                                      serve entries over a local HTTP API")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck gallery [flags] <config>")
+	fmt.Fprintln(w, "                                                      write an HTML preview of a prepared folder")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-profile [flags] <config>")
+	fmt.Fprintln(w, "                                                      write a .streamDeckProfile for the Stream Deck app")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck import-profile [flags] <profile>")
+	fmt.Fprintln(w, "                                                      turn a .streamDeckProfile into a prepared folder")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-companion [flags] <config>")
+	fmt.Fprintln(w, "                                                      write a Bitfocus Companion page import file")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-openstage [flags] <config>")
+	fmt.Fprintln(w, "                                                      write an Open Stage Control session")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-touchosc [flags] <config>")
+	fmt.Fprintln(w, "                                                      write a TouchOSC layout")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-template [flags] <template> <config>")
+	fmt.Fprintln(w, "                                                      render a text/template against a prepared folder")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck export-csv [flags] <config>")
+	fmt.Fprintln(w, "                                                      write the entries as CSV for a spreadsheet")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck import-csv [flags] <csv> <config>")
+	fmt.Fprintln(w, "                                                      apply an edited CSV to its media_config.json")
+	fmt.Fprintln(w, "  cli-prepare-for-streamdeck layout [flags] <config>")
+	fmt.Fprintln(w, "                                                      split the entries into pages with navigation keys")
+}
+
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// prepareCmd prepares a media folder with the choices of the wizard given
+// as flags, for scripts and scheduled jobs
+func prepareCmd(args []string) int { // nolint:cyclop
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	registry := newExporterRegistry(cfg)
+
+	fs := flag.NewFlagSet("prepare", flag.ContinueOnError)
+	mediaType := fs.String("type", "image", "media type: image, video or audio")
+	oscName := fs.String("osc", "", "name of the OSC prefix option to use (default: the first one)")
+	prefix := fs.String("prefix", "", "custom OSC prefix or address template, instead of --osc")
+	targets := fs.String("targets", "", "OSC targets as host:port, comma separated (default: those of the option)")
+	borderName := fs.String("border-style", "Solid", "name of the border style of pressed images")
+	borderColor := fs.String("border-color", cfg.BorderColor, "color of the solid border style")
+	borderWidth := fs.Int("border-width", cfg.BorderWidth, "border width of pressed images in pixels")
+	metaTitles := fs.Bool("metadata-titles", cfg.TitleFromMetadata, "take image titles from EXIF/XMP metadata")
+	pages := fs.Bool("pages", cfg.PageLayout.Enabled, "split the entries into pages with navigation keys (see the layout command)")
+	device := fs.String("device", cfg.PageLayout.Device, "device profile to lay the pages out for (default: the first one)")
+	var formats stringList
+	fs.Var(&formats, "format", "output format, may be repeated: "+strings.Join(registry.names(), ", ")+" (default: json)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck prepare [flags] <folder>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := prepareOptions{
+		BorderWidth:       *borderWidth,
+		Output:            cfg.Output,
+		TitleFromMetadata: *metaTitles,
+	}
+	usage := func(err error) int {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	switch strings.ToLower(*mediaType) {
+	case config.ImageType.String():
+		opts.MediaType = config.ImageType
+	case config.VideoType.String():
+		opts.MediaType = config.VideoType
+	case config.AudioType.String():
+		opts.MediaType = config.AudioType
+	default:
+		return usage(fmt.Errorf("unknown media type %q, choose image, video or audio", *mediaType))
+	}
+	opts.TitleFromMetadata = opts.TitleFromMetadata && opts.MediaType == config.ImageType
+
+	if *prefix != "" {
+		if opts.OscOption, err = customOscOption(*prefix); err != nil {
+			return usage(err)
+		}
+	} else if opts.OscOption, err = findOscOption(cfg.OscPrefixOptions, *oscName); err != nil {
+		return usage(err)
+	}
+	if *targets != "" {
+		if opts.OscOption.Targets, err = config.ParseOscTargets(*targets); err != nil {
+			return usage(err)
+		}
+	}
+
+	if opts.BorderStyle, err = findBorderStyle(cfg.BorderStyles, *borderName, *borderColor); err != nil {
+		return usage(err)
+	}
+
+	if *pages {
+		layout := cfg.PageLayout
+		layout.Device = *device
+		if opts.Pages, err = newPageOptions(cfg.Devices(), layout); err != nil {
+			return usage(err)
+		}
+	}
+
+	if len(formats) == 0 {
+		formats = stringList{jsonExporter{}.Name()}
+	}
+	for _, name := range formats {
+		exporter, err := registry.find(name)
+		if err != nil {
+			return usage(err)
+		}
+		opts.Exporters = append(opts.Exporters, exporter)
+	}
+
+	if err := processMediaFiles(fs.Arg(0), opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// findOscOption looks an OSC prefix option up by name, ignoring case. An
+// empty name picks the first option.
+func findOscOption(options []config.OscPrefixOption, name string) (config.OscPrefixOption, error) {
+	if name == "" && len(options) > 0 {
+		return options[0], nil
+	}
+	names := make([]string, 0, len(options))
+	for _, option := range options {
+		if strings.EqualFold(option.Name, name) {
+			return option, nil
+		}
+		names = append(names, option.Name)
+	}
+	return config.OscPrefixOption{}, fmt.Errorf("unknown OSC option %q, choose one of: %s", name, strings.Join(names, ", "))
+}
+
+// findBorderStyle looks a border style up by name, ignoring case. Solid is
+// always available and uses the given color.
+func findBorderStyle(styles []config.BorderStyle, name, color string) (config.BorderStyle, error) {
+	all := append([]config.BorderStyle{solidBorderStyle(color)}, styles...)
+	names := make([]string, 0, len(all))
+	for _, style := range all {
+		if strings.EqualFold(style.Name, name) {
+			return style, nil
+		}
+		names = append(names, style.Name)
+	}
+	return config.BorderStyle{}, fmt.Errorf("unknown border style %q, choose one of: %s", name, strings.Join(names, ", "))
+}
+
+// runCmd runs the actions of one entry, given by its 1-based index or title
+func runCmd(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", defaultScriptTimeout, "time limit for each script")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck run [flags] <config> <entry>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder, <entry> a 1-based index or a title.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	index, err := findEntry(media, fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result := runEntry(ctx, media.Files[index], runOptions{Dir: dir, Timeout: *timeout, Index: index})
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(result)
+	} else {
+		printRunResult(os.Stdout, result)
+	}
+
+	if !result.OK {
+		return 1
+	}
+	return 0
+}
+
+// findEntry looks an entry up by its 1-based index or, failing that, by its
+// title, ignoring case
+func findEntry(media *MediaConfig, key string) (int, error) {
+	if n, err := strconv.Atoi(key); err == nil {
+		if n < 1 || n > len(media.Files) {
+			return 0, fmt.Errorf("entry %d is out of range, the config has %d entries", n, len(media.Files))
+		}
+		return n - 1, nil
+	}
+
+	found := -1
+	for i, entry := range media.Files {
+		if !strings.EqualFold(entry.Title, key) {
+			continue
+		}
+		if found >= 0 {
+			return 0, fmt.Errorf("several entries are titled %q, use the index instead", key)
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("no entry titled %q", key)
+	}
+	return found, nil
+}
+
+// printRunResult lists the steps of a run with the output of each script
+func printRunResult(w io.Writer, result runResult) {
+	fmt.Fprintf(w, "%d. %s\n", result.Index, result.Title)
+	for _, step := range result.Steps {
+		status := "ok"
+		if step.Error != "" {
+			status = "failed"
+		}
+		fmt.Fprintf(w, "  [%s] %s %s (%d ms)\n", status, step.Kind, step.Action, step.Duration)
+		if step.Error != "" {
+			fmt.Fprintf(w, "    error: %s\n", step.Error)
+		}
+		for _, line := range strings.Split(strings.TrimRight(step.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+	if len(result.Steps) == 0 {
+		fmt.Fprintln(w, "  no actions")
+	}
+}
+
+// loadConfigIfPresent loads config.json from the current folder, or returns
+// the defaults without writing one as the interactive tool would
+func loadConfigIfPresent() (*config.Config, error) {
+	if _, err := os.Stat("config.json"); err != nil {
+		return &config.DefaultConfig, nil
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %v", err)
+	}
+	return cfg, nil
+}
+
+// mediaDeviceProfile picks the device to show a config on: the named one,
+// or else the one its pages were laid out for, or else the first profile.
+// Any other device than the layout's gets the keys in order, which is
+// warned about.
+func mediaDeviceProfile(devices []config.DeviceProfile, media *MediaConfig, name string) (config.DeviceProfile, error) {
+	if media.Device == "" || strings.EqualFold(name, media.Device) {
+		return findDeviceProfile(devices, name)
+	}
+	if name != "" {
+		device, err := findDeviceProfile(devices, name)
+		if err == nil {
+			fmt.Printf("Warning: the pages are laid out for the %s, the keys of the %s are filled in order\n", media.Device, device.Name)
+		}
+		return device, err
+	}
+	device, err := findDeviceProfile(devices, media.Device)
+	if err != nil {
+		fmt.Printf("Warning: the pages are laid out for the %s, which is not a device profile, the keys of the %s are filled in order\n", media.Device, devices[0].Name)
+		return devices[0], nil
+	}
+	return device, nil
+}
+
+// findDeviceProfile looks a device profile up by name, ignoring case. An
+// empty name picks the first profile.
+func findDeviceProfile(devices []config.DeviceProfile, name string) (config.DeviceProfile, error) {
+	if name == "" {
+		return devices[0], nil
+	}
+	names := make([]string, 0, len(devices))
+	for _, device := range devices {
+		if strings.EqualFold(device.Name, name) {
+			return device, nil
+		}
+		names = append(names, device.Name)
+	}
+	return config.DeviceProfile{}, fmt.Errorf("unknown device %q, choose one of: %s", name, strings.Join(names, ", "))
+}
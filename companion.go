@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+const (
+	companionExtension = ".companionconfig"
+	// companionVersion is the export format of Companion 3 whose pages are
+	// laid out as rows of columns; newer versions upgrade it on import
+	companionVersion = 4
+	companionRows    = 4
+	companionCols    = 8
+	// companionKeySize is the edge of a Companion button in pixels
+	companionKeySize = 72
+	companionModule  = "generic-osc"
+)
+
+// companionExport is a Companion page export with the connections its
+// buttons use
+type companionExport struct {
+	Instances     map[string]companionInstance `json:"instances"`
+	Type          string                       `json:"type"`
+	Page          companionPage                `json:"page"`
+	Version       int                          `json:"version"`
+	OldPageNumber int                          `json:"oldPageNumber"`
+}
+
+// companionPage holds the buttons keyed by row, then column
+type companionPage struct {
+	Controls map[string]map[string]companionButton `json:"controls"`
+	Name     string                                `json:"name"`
+}
+
+// companionInstance is a generic OSC connection to one host and port
+type companionInstance struct {
+	Config       companionOscConfig `json:"config"`
+	InstanceType string             `json:"instance_type"`
+	Label        string             `json:"label"`
+	SortOrder    int                `json:"sortOrder"`
+	Enabled      bool               `json:"enabled"`
+}
+
+type companionOscConfig struct {
+	Host       string `json:"host"`
+	Protocol   string `json:"protocol"`
+	TargetPort int    `json:"targetPort"`
+}
+
+type companionButton struct {
+	Options   map[string]any           `json:"options"`
+	Steps     map[string]companionStep `json:"steps"`
+	Type      string                   `json:"type"`
+	Style     companionStyle           `json:"style"`
+	Feedbacks []any                    `json:"feedbacks"`
+}
+
+type companionStyle struct {
+	Text         string `json:"text"`
+	Size         string `json:"size"`
+	Png64        string `json:"png64,omitempty"`
+	Alignment    string `json:"alignment"`
+	PngAlignment string `json:"pngalignment"`
+	Color        int    `json:"color"`
+	BgColor      int    `json:"bgcolor"`
+}
+
+type companionStep struct {
+	ActionSets map[string][]companionAction `json:"action_sets"`
+	Options    map[string]any               `json:"options"`
+}
+
+// companionAction is one action of a button. Delay is in milliseconds after
+// the previous action, as the buttons use relative delays.
+type companionAction struct {
+	Options  map[string]any `json:"options"`
+	ID       string         `json:"id"`
+	Action   string         `json:"action"`
+	Instance string         `json:"instance"`
+	Delay    int            `json:"delay"`
+}
+
+// exportCompanionCmd writes a Companion page import file for a prepared folder
+func exportCompanionCmd(args []string) int {
+	fs := flag.NewFlagSet("export-companion", flag.ContinueOnError)
+	name := fs.String("name", "", "page name (default: the folder name)")
+	out := fs.String("out", "", "file to write (default: <name>"+companionExtension+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck export-companion [flags] <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+
+	if *name == "" {
+		*name = filepath.Base(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			*name = filepath.Base(abs)
+		}
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, *name+companionExtension)
+	}
+
+	export := buildCompanionExport(media, dir, *name)
+	jsonData, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating JSON: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(path, jsonData, 0644); err != nil { // nolint:gosec
+		fmt.Fprintf(os.Stderr, "Error saving Companion page: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Companion page with %d buttons and %d connections saved to %s\n",
+		min(len(media.Files), companionRows*companionCols), len(export.Instances), path)
+	return 0
+}
+
+// buildCompanionExport lays the entries out row by row on one Companion
+// page. Each OSC target becomes a generic OSC connection, and pressing a
+// button sends the entry's commands through them.
+func buildCompanionExport(media *MediaConfig, dir, name string) companionExport {
+	export := companionExport{
+		Version:       companionVersion,
+		Type:          "page",
+		OldPageNumber: 1,
+		Instances:     map[string]companionInstance{},
+		Page:          companionPage{Name: name, Controls: map[string]map[string]companionButton{}},
+	}
+	instances := map[config.OscTarget]string{}
+
+	if len(media.Files) > companionRows*companionCols {
+		fmt.Printf("Warning: a Companion page has %d buttons, leaving out the last %d entries\n",
+			companionRows*companionCols, len(media.Files)-companionRows*companionCols)
+	}
+
+	for i, entry := range media.Files {
+		if i >= companionRows*companionCols {
+			break
+		}
+
+		button := companionButton{
+			Type: "button",
+			Style: companionStyle{
+				Text:         entry.Title,
+				Size:         "auto",
+				Alignment:    "center:bottom",
+				PngAlignment: "center:center",
+				Color:        0xFFFFFF,
+			},
+			Options:   map[string]any{"relativeDelay": true, "stepAutoProgress": true},
+			Feedbacks: []any{},
+		}
+		if entry.Image != "" {
+			png64, err := companionImage(filepath.Join(dir, entry.Image))
+			if err != nil {
+				fmt.Printf("Warning: %s has no button image: %v\n", entry.Title, err)
+			}
+			button.Style.Png64 = png64
+		}
+		if len(entry.Scripts) > 0 || len(entry.ScriptPaths) > 0 {
+			fmt.Printf("Warning: %s runs scripts, which Companion buttons cannot\n", entry.Title)
+		}
+
+		down := []companionAction{}
+		delay := 0
+		for c, cmd := range entry.OscCommands {
+			delay += entryDelay(entry, c)
+			action, err := companionOscAction(cmd)
+			if err != nil {
+				fmt.Printf("Warning: %s: %v\n", entry.Title, err)
+				continue
+			}
+
+			// Connections are only added for targets a button sends to
+			target := oscTarget(cmd)
+			id, ok := instances[target]
+			if !ok {
+				id = newProfileUUID()
+				instances[target] = id
+				export.Instances[id] = companionConnection(target, len(instances))
+			}
+			action.ID = newProfileUUID()
+			action.Instance = id
+			action.Delay = delay
+			down = append(down, action)
+			delay = 0
+		}
+		button.Steps = map[string]companionStep{
+			"0": {
+				ActionSets: map[string][]companionAction{"down": down, "up": {}},
+				Options:    map[string]any{"runWhileHeld": []int{}},
+			},
+		}
+
+		row, col := strconv.Itoa(i/companionCols), strconv.Itoa(i%companionCols)
+		if export.Page.Controls[row] == nil {
+			export.Page.Controls[row] = map[string]companionButton{}
+		}
+		export.Page.Controls[row][col] = button
+	}
+
+	return export
+}
+
+// companionConnection describes a generic OSC connection to a target. Its
+// label is what Companion shows in variables, so it only uses the
+// characters Companion allows there.
+func companionConnection(target config.OscTarget, order int) companionInstance {
+	protocol := "udp"
+	switch target.Transport {
+	case osc.TCPSLIP:
+		protocol = "tcp"
+	case osc.TCPLengthPrefixed:
+		fmt.Printf("Warning: Companion cannot send length-prefixed OSC over TCP, %s uses raw TCP\n", target)
+		protocol = "tcp-raw"
+	}
+	label := strings.NewReplacer(".", "_", ":", "_").Replace(fmt.Sprintf("osc_%s_%d", target.Host, target.Port))
+	return companionInstance{
+		InstanceType: companionModule,
+		Label:        label,
+		SortOrder:    order,
+		Enabled:      true,
+		Config:       companionOscConfig{Host: target.Host, TargetPort: target.Port, Protocol: protocol},
+	}
+}
+
+// companionOscAction picks the generic OSC action for the arguments of a
+// command: a typed action for a single argument, and a list otherwise
+func companionOscAction(cmd OscCommand) (companionAction, error) {
+	msg, err := oscMessage(cmd)
+	if err != nil {
+		return companionAction{}, err
+	}
+
+	options := map[string]any{"path": cmd.OscPath}
+	if len(msg.Arguments) == 0 {
+		return companionAction{Action: "send_blank", Options: options}, nil
+	}
+	if len(msg.Arguments) == 1 {
+		switch v := msg.Arguments[0].(type) {
+		case int32:
+			options["int"] = v
+			return companionAction{Action: "send_int", Options: options}, nil
+		case float32:
+			options["float"] = v
+			return companionAction{Action: "send_float", Options: options}, nil
+		case string:
+			options["string"] = v
+			return companionAction{Action: "send_string", Options: options}, nil
+		}
+	}
+
+	// The list is parsed by Companion: whole numbers are ints, numbers with
+	// a decimal point floats and quoted text strings
+	args := make([]string, 0, len(msg.Arguments))
+	for _, arg := range msg.Arguments {
+		switch v := arg.(type) {
+		case int32:
+			args = append(args, strconv.Itoa(int(v)))
+		case float32:
+			text := strconv.FormatFloat(float64(v), 'f', -1, 32)
+			if !strings.Contains(text, ".") {
+				text += ".0"
+			}
+			args = append(args, text)
+		case string:
+			args = append(args, strconv.Quote(v))
+		default:
+			return companionAction{}, fmt.Errorf("%s: Companion cannot send the argument %v", cmd.OscPath, arg)
+		}
+	}
+	options["arguments"] = strings.Join(args, " ")
+	return companionAction{Action: "send_multiple", Options: options}, nil
+}
+
+// companionImage returns an image scaled to a Companion button as a PNG data URL
+func companionImage(path string) (string, error) {
+	img, err := loadThumbnail(path, companionKeySize)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// companionExporter writes a Bitfocus Companion page
+type companionExporter struct{}
+
+func (companionExporter) Name() string      { return "companion" }
+func (companionExporter) Extension() string { return companionExtension }
+
+func (companionExporter) Export(media MediaConfig, outDir string) (string, error) {
+	name := exportName(outDir)
+	jsonData, err := json.MarshalIndent(buildCompanionExport(&media, outDir, name), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error creating JSON: %v", err)
+	}
+	path := filepath.Join(outDir, name+companionExtension)
+	if err := os.WriteFile(path, jsonData, 0644); err != nil { // nolint:gosec
+		return "", err
+	}
+	return path, nil
+}
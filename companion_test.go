@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestCompanionExportSkipsUnusedConnections(t *testing.T) {
+	media := &MediaConfig{Files: []MediaEntry{{
+		Title: "Intro",
+		OscCommands: []OscCommand{
+			// Cannot be sent, so its target must not become a connection
+			{OscPath: "/clip/1", OscTypeTags: "i", OscValue: []any{"one"}, OscHost: "10.0.0.9", OscPort: 9000},
+			{OscPath: "/clip/1/go", OscHost: "10.0.0.5", OscPort: 7000},
+		},
+		Delays: []int{100, 50},
+	}}}
+
+	export := buildCompanionExport(media, t.TempDir(), "Show")
+
+	if len(export.Instances) != 1 {
+		t.Fatalf("export has %d connections, want 1: %+v", len(export.Instances), export.Instances)
+	}
+	var id string
+	for key, instance := range export.Instances {
+		id = key
+		if instance.Config.Host != "10.0.0.5" || instance.Config.TargetPort != 7000 || instance.SortOrder != 1 {
+			t.Errorf("connection is %+v, want 10.0.0.5:7000 first", instance)
+		}
+	}
+
+	down := export.Page.Controls["0"]["0"].Steps["0"].ActionSets["down"]
+	if len(down) != 1 {
+		t.Fatalf("button has %d actions, want 1", len(down))
+	}
+	// The skipped command's delay still passes before the next one
+	if down[0].Instance != id || down[0].Delay != 150 {
+		t.Errorf("action uses %s after %dms, want %s after 150ms", down[0].Instance, down[0].Delay, id)
+	}
+}
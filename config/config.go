@@ -3,6 +3,9 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
 )
 
 type MediaType int
@@ -13,6 +16,18 @@ const (
 	AudioType
 )
 
+func (t MediaType) String() string {
+	switch t {
+	case ImageType:
+		return "image"
+	case VideoType:
+		return "video"
+	case AudioType:
+		return "audio"
+	}
+	return "unknown"
+}
+
 type OscPrefixType string
 
 const (
@@ -20,29 +35,221 @@ const (
 	OscSerialType   OscPrefixType = "serial"
 )
 
+type OscArgType string
+
+const (
+	OscIntArg    OscArgType = "int"
+	OscFloatArg  OscArgType = "float"
+	OscStringArg OscArgType = "string"
+	OscBoolArg   OscArgType = "bool"
+)
+
+// OscArgumentSpec describes one typed OSC argument. The template is a Go
+// text/template executed against TemplateData; numeric results may contain
+// arithmetic, e.g. "{{.Base}}+{{.Index}}*10".
+type OscArgumentSpec struct {
+	Type     OscArgType `json:"type"`
+	Template string     `json:"template"`
+}
+
+// OscTarget is a receiver OSC commands are sent to. Transport is "udp"
+// (the default), "tcp-slip" or "tcp-length-prefixed".
+type OscTarget struct {
+	Host      string        `json:"host"`
+	Transport osc.Transport `json:"transport"`
+	Port      int           `json:"port"`
+}
+
+const (
+	DefaultOscHost = "127.0.0.1"
+	DefaultOscPort = 8000
+)
+
+// OscCommandTemplate is one command of a multi-command option. Address is a
+// template like AddressTemplate, Targets default to the option's receivers
+// and Delay is the pause in milliseconds before the command is sent.
+type OscCommandTemplate struct {
+	Address   string            `json:"address"`
+	Arguments []OscArgumentSpec `json:"arguments"`
+	Targets   []OscTarget       `json:"targets"`
+	Delay     int               `json:"delay"`
+}
+
+// OscPrefixOption describes how OSC commands are generated. When Arguments
+// is empty a single int is sent, derived from ArgumentType and ArgumentBase.
+// An AddressTemplate replaces Prefix and AugmentIndex; IndexPadding sets the
+// zero padding of the index (default 2). Commands go to Host and Port, or to
+// every entry of Targets when it is set. A non-empty Commands list replaces
+// the single generated command with one command per template, in order.
+// Bundle sends the commands of an entry as one OSC bundle per target, to be
+// run BundleDelay milliseconds after sending, or on arrival when zero.
 type OscPrefixOption struct {
-	Name         string        `json:"name"`
-	Prefix       string        `json:"prefix"`
-	ArgumentType OscPrefixType `json:"argument_type"`
-	ArgumentBase int           `json:"argument_base"`
-	AugmentIndex bool          `json:"augment_index"`
+	Name            string               `json:"name"`
+	Prefix          string               `json:"prefix"`
+	AddressTemplate string               `json:"address_template"`
+	Host            string               `json:"host"`
+	Transport       osc.Transport        `json:"transport"`
+	ArgumentType    OscPrefixType        `json:"argument_type"`
+	Arguments       []OscArgumentSpec    `json:"arguments"`
+	Targets         []OscTarget          `json:"targets"`
+	Commands        []OscCommandTemplate `json:"commands"`
+	ArgumentBase    int                  `json:"argument_base"`
+	IndexPadding    int                  `json:"index_padding"`
+	Port            int                  `json:"port"`
+	BundleDelay     int                  `json:"bundle_delay"`
+	AugmentIndex    bool                 `json:"augment_index"`
+	Bundle          bool                 `json:"bundle"`
+}
+
+// OscTargets returns the receivers of the option, falling back to the
+// default host and port when they are not set
+func (o OscPrefixOption) OscTargets() []OscTarget {
+	if len(o.Targets) > 0 {
+		return o.Targets
+	}
+
+	target := OscTarget{Host: o.Host, Port: o.Port, Transport: o.Transport}
+	if target.Host == "" {
+		target.Host = DefaultOscHost
+	}
+	if target.Port == 0 {
+		target.Port = DefaultOscPort
+	}
+	return []OscTarget{target}
+}
+
+// DisplayAddress returns the address templates, or the prefix if there are none
+func (o OscPrefixOption) DisplayAddress() string {
+	if len(o.Commands) > 0 {
+		addresses := make([]string, 0, len(o.Commands))
+		for _, cmd := range o.Commands {
+			addresses = append(addresses, cmd.Address)
+		}
+		return strings.Join(addresses, "; ")
+	}
+	if o.AddressTemplate != "" {
+		return o.AddressTemplate
+	}
+	return o.Prefix
+}
+
+type BorderStyleKind string
+
+const (
+	BorderSolid          BorderStyleKind = "solid"
+	BorderLinearGradient BorderStyleKind = "linear_gradient"
+	BorderRadialGradient BorderStyleKind = "radial_gradient"
+	BorderDashed         BorderStyleKind = "dashed"
+	BorderDouble         BorderStyleKind = "double"
+)
+
+// BorderStyle describes how the border of a pressed image is painted.
+// Gradients blend evenly between all Colors. Dashed and double borders use
+// the first colour for the lines and the optional second one for the gaps,
+// which are left transparent otherwise.
+type BorderStyle struct {
+	Name       string          `json:"name"`
+	Kind       BorderStyleKind `json:"kind"`
+	Colors     []string        `json:"colors"`
+	Angle      float64         `json:"angle"`
+	DashLength int             `json:"dash_length"`
+}
+
+type ImageFormat string
+
+const (
+	FormatSource ImageFormat = ""
+	FormatPNG    ImageFormat = "png"
+	FormatJPEG   ImageFormat = "jpg"
+	FormatWebP   ImageFormat = "webp"
+)
+
+type PNGCompression string
+
+const (
+	PNGDefaultCompression PNGCompression = "default"
+	PNGNoCompression      PNGCompression = "none"
+	PNGBestSpeed          PNGCompression = "speed"
+	PNGBestCompression    PNGCompression = "best"
+)
+
+// OutputSettings controls how generated key images are encoded. An empty
+// format keeps the source format for images and uses JPEG for video frames.
+// A MaxBytes of zero disables the size budget.
+type OutputSettings struct {
+	Format         ImageFormat    `json:"format"`
+	PNGCompression PNGCompression `json:"png_compression"`
+	JPEGQuality    int            `json:"jpeg_quality"`
+	MaxBytes       int            `json:"max_bytes"`
 }
 
 type Config struct {
-	BorderColor      string            `json:"border_color"`
-	OscPrefixOptions []OscPrefixOption `json:"osc_prefix_options"`
-	BorderWidth      int               `json:"border_width"`
+	BorderColor       string                    `json:"border_color"`
+	Output            OutputSettings            `json:"output"`
+	OscPrefixOptions  []OscPrefixOption         `json:"osc_prefix_options"`
+	BorderStyles      []BorderStyle             `json:"border_styles"`
+	DeviceProfiles    []DeviceProfile           `json:"device_profiles"`
+	StreamDeckProfile StreamDeckProfileSettings `json:"streamdeck_profile"`
+	TabletLayout      TabletLayout              `json:"tablet_layout"`
+	PageLayout        PageLayout                `json:"page_layout"`
+	TemplatesDir      string                    `json:"templates_dir"`
+	BorderWidth       int                       `json:"border_width"`
+	TitleFromMetadata bool                      `json:"title_from_metadata"`
 }
 
 var DefaultConfig = Config{
 	BorderColor: "#FFFFFF",
 	BorderWidth: 5,
+	Output: OutputSettings{
+		Format:         FormatSource,
+		PNGCompression: PNGDefaultCompression,
+		JPEGQuality:    90,
+		MaxBytes:       0,
+	},
 	OscPrefixOptions: []OscPrefixOption{
-		{Name: "Option 1", Prefix: "/streamdeck/option_1", ArgumentType: "serial", ArgumentBase: 1},
+		{Name: "Option 1", Prefix: "/streamdeck/option_1", ArgumentType: "serial", ArgumentBase: 1, Host: DefaultOscHost, Port: DefaultOscPort},
 		{Name: "Option 2", Prefix: "/streamdeck/option_2", ArgumentType: "constant", ArgumentBase: 1},
 		{Name: "Option 3", Prefix: "/streamdeck/option_3", ArgumentType: "serial", ArgumentBase: 1},
+		{Name: "Media Server", AddressTemplate: "/layer/1/clip/{{.PaddedIndex}}/connect", ArgumentType: "serial", ArgumentBase: 1,
+			Arguments: []OscArgumentSpec{
+				{Type: OscIntArg, Template: "{{.Base}}+{{.Index}}*10"},
+				{Type: OscStringArg, Template: "{{.Title}}"},
+			},
+			Targets: []OscTarget{
+				{Host: DefaultOscHost, Port: 7000},
+				{Host: DefaultOscHost, Port: 8000},
+			}},
+		{Name: "Clip Sequence", ArgumentBase: 1, Host: DefaultOscHost, Port: 7000,
+			Commands: []OscCommandTemplate{
+				{Address: "/composition/layers/1/clips/{{.Index}}/connect", Arguments: []OscArgumentSpec{{Type: OscIntArg, Template: "1"}}},
+				{Address: "/composition/layers/1/video/opacity", Arguments: []OscArgumentSpec{{Type: OscFloatArg, Template: "1.0"}}},
+				{Address: "/composition/layers/1/transport/position", Arguments: []OscArgumentSpec{{Type: OscFloatArg, Template: "0"}}, Delay: 100},
+			}},
 		{Name: "Custom", Prefix: "", ArgumentType: "constant", ArgumentBase: 1},
 	},
+	BorderStyles: []BorderStyle{
+		{Name: "Gold Gradient", Kind: BorderLinearGradient, Colors: []string{"#FFD700", "#FF8C00"}, Angle: 45},
+		{Name: "Spotlight", Kind: BorderRadialGradient, Colors: []string{"#FFFFFF", "#3050FF"}},
+		{Name: "Dashed", Kind: BorderDashed, Colors: []string{"#FFFFFF", "#000000"}, DashLength: 8},
+		{Name: "Double", Kind: BorderDouble, Colors: []string{"#FFFFFF"}},
+	},
+	DeviceProfiles:    DefaultDeviceProfiles,
+	StreamDeckProfile: DefaultStreamDeckProfileSettings,
+	TabletLayout:      DefaultTabletLayout,
+	TemplatesDir:      DefaultTemplatesDir,
+}
+
+// DefaultTemplatesDir is the folder next to config.json holding the output
+// templates
+const DefaultTemplatesDir = "templates"
+
+// Templates returns the folder of the output templates, or the default for
+// configs written before it existed
+func (c *Config) Templates() string {
+	if c.TemplatesDir == "" {
+		return DefaultTemplatesDir
+	}
+	return c.TemplatesDir
 }
 
 func LoadConfig() (*Config, error) {
@@ -62,6 +269,11 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// Fail early on templates that would only break while processing files
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
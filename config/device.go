@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DeviceProfile describes the key grid of a Stream Deck model. KeySize is the
+// edge of a key image in pixels and Model the identifier the Stream Deck app
+// records in profiles.
+type DeviceProfile struct {
+	Name    string `json:"name"`
+	Model   string `json:"model"`
+	Rows    int    `json:"rows"`
+	Cols    int    `json:"cols"`
+	KeySize int    `json:"key_size"`
+}
+
+// DefaultDeviceProfiles are the current Stream Deck models
+var DefaultDeviceProfiles = []DeviceProfile{
+	{Name: "Stream Deck", Model: "20GBA9901", Rows: 3, Cols: 5, KeySize: 72},
+	{Name: "Stream Deck Mini", Model: "20GAI9901", Rows: 2, Cols: 3, KeySize: 80},
+	{Name: "Stream Deck XL", Model: "20GAT9901", Rows: 4, Cols: 8, KeySize: 96},
+	{Name: "Stream Deck +", Model: "20GBD9901", Rows: 2, Cols: 4, KeySize: 120},
+	{Name: "Stream Deck Neo", Model: "20GBJ9901", Rows: 2, Cols: 4, KeySize: 96},
+}
+
+// Keys returns the number of keys on the device
+func (d DeviceProfile) Keys() int {
+	return d.Rows * d.Cols
+}
+
+// Validate checks that the profile describes a usable grid
+func (d DeviceProfile) Validate() error {
+	if d.Name == "" {
+		return errors.New("device profile name cannot be empty")
+	}
+	if d.Rows < 1 || d.Cols < 1 {
+		return fmt.Errorf("device profile %q needs at least one row and column", d.Name)
+	}
+	if d.KeySize < 0 {
+		return fmt.Errorf("device profile %q has a negative key size", d.Name)
+	}
+	return nil
+}
+
+// Devices returns the configured device profiles, or the defaults for
+// configs written before profiles existed
+func (c *Config) Devices() []DeviceProfile {
+	if len(c.DeviceProfiles) > 0 {
+		return c.DeviceProfiles
+	}
+	return DefaultDeviceProfiles
+}
+
+// StreamDeckProfileSettings controls the .streamDeckProfile export. Every
+// entry becomes an ActionUUID action, by default the built-in Open action
+// pointing at the media file. Device names the device profile to lay the
+// keys out for, the first one when empty.
+type StreamDeckProfileSettings struct {
+	Device     string `json:"device"`
+	ActionUUID string `json:"action_uuid"`
+	ActionName string `json:"action_name"`
+}
+
+// DefaultStreamDeckProfileSettings uses the Open action of the Stream Deck app
+var DefaultStreamDeckProfileSettings = StreamDeckProfileSettings{
+	ActionUUID: "com.elgato.streamdeck.system.open",
+	ActionName: "Open",
+}
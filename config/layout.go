@@ -0,0 +1,51 @@
+package config
+
+import "fmt"
+
+// TabletLayout is the button grid of the tablet exports (Open Stage Control
+// and TouchOSC). Width and Height are the size of the layout in pixels,
+// which the grid divides evenly.
+type TabletLayout struct {
+	Rows   int `json:"rows"`
+	Cols   int `json:"cols"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// DefaultTabletLayout fits a landscape tablet
+var DefaultTabletLayout = TabletLayout{Rows: 4, Cols: 6, Width: 1024, Height: 768}
+
+// Buttons returns the number of buttons on a page of the layout
+func (l TabletLayout) Buttons() int {
+	return l.Rows * l.Cols
+}
+
+// Validate checks that the layout has room for at least one button
+func (l TabletLayout) Validate() error {
+	if l.Rows < 1 || l.Cols < 1 {
+		return fmt.Errorf("tablet layout needs at least one row and column, got %dx%d", l.Cols, l.Rows)
+	}
+	if l.Width < l.Cols || l.Height < l.Rows {
+		return fmt.Errorf("tablet layout of %dx%d pixels is too small for %dx%d buttons", l.Width, l.Height, l.Cols, l.Rows)
+	}
+	return nil
+}
+
+// Layout returns the configured tablet layout, with the defaults for the
+// fields a config leaves out
+func (c *Config) Layout() TabletLayout {
+	layout := c.TabletLayout
+	if layout.Rows == 0 {
+		layout.Rows = DefaultTabletLayout.Rows
+	}
+	if layout.Cols == 0 {
+		layout.Cols = DefaultTabletLayout.Cols
+	}
+	if layout.Width == 0 {
+		layout.Width = DefaultTabletLayout.Width
+	}
+	if layout.Height == 0 {
+		layout.Height = DefaultTabletLayout.Height
+	}
+	return layout
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PageLayout controls how prepared entries are split into pages of a device
+// profile when they do not fit on one. Previous, Home and Next are the keys
+// kept free for navigation on every page, numbered from 1 at the top left
+// row by row; 0 puts a key in its default place and -1 leaves it out.
+// Device names the device profile, the first one when empty, and Enabled
+// lays out the pages of every prepared folder.
+type PageLayout struct {
+	Device   string `json:"device"`
+	Previous int    `json:"previous"`
+	Home     int    `json:"home"`
+	Next     int    `json:"next"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// NavigationKeys are the keys a page layout keeps free on a device, counted
+// from 0 row by row, or -1 for keys left out
+type NavigationKeys struct {
+	Previous int
+	Home     int
+	Next     int
+}
+
+// Slots returns the keys in use
+func (n NavigationKeys) Slots() []int {
+	var slots []int
+	for _, slot := range []int{n.Previous, n.Home, n.Next} {
+		if slot >= 0 {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// Validate checks the key numbers that do not depend on the device
+func (l PageLayout) Validate() error {
+	for _, key := range []struct {
+		name   string
+		number int
+	}{{"previous", l.Previous}, {"home", l.Home}, {"next", l.Next}} {
+		if key.number < -1 {
+			return fmt.Errorf("page layout %s key must be a key number, 0 for the default or -1 for none, got %d", key.name, key.number)
+		}
+	}
+	if l.Previous == -1 && l.Next == -1 {
+		return errors.New("page layout needs a previous or next key")
+	}
+	return nil
+}
+
+// Keys places the navigation keys on a device. By default previous and next
+// take the ends of the bottom row and home its middle, on devices with at
+// least three columns.
+func (l PageLayout) Keys(device DeviceProfile) (NavigationKeys, error) {
+	if err := l.Validate(); err != nil {
+		return NavigationKeys{}, err
+	}
+
+	bottom := (device.Rows - 1) * device.Cols
+	defaults := NavigationKeys{Previous: bottom, Home: -1, Next: device.Keys() - 1}
+	if device.Cols >= 3 {
+		defaults.Home = bottom + device.Cols/2
+	}
+
+	place := func(name string, number, fallback int) (int, error) {
+		switch {
+		case number == 0:
+			return fallback, nil
+		case number < 0:
+			return -1, nil
+		case number > device.Keys():
+			return 0, fmt.Errorf("page layout %s key %d is not on a %s with %d keys", name, number, device.Name, device.Keys())
+		}
+		return number - 1, nil
+	}
+
+	var keys NavigationKeys
+	var err error
+	if keys.Previous, err = place("previous", l.Previous, defaults.Previous); err != nil {
+		return NavigationKeys{}, err
+	}
+	if keys.Home, err = place("home", l.Home, defaults.Home); err != nil {
+		return NavigationKeys{}, err
+	}
+	if keys.Next, err = place("next", l.Next, defaults.Next); err != nil {
+		return NavigationKeys{}, err
+	}
+
+	used := map[int]bool{}
+	for _, slot := range keys.Slots() {
+		if used[slot] {
+			return NavigationKeys{}, fmt.Errorf("page layout puts two navigation keys on key %d of a %s", slot+1, device.Name)
+		}
+		used[slot] = true
+	}
+	if len(used) >= device.Keys() {
+		return NavigationKeys{}, fmt.Errorf("page layout leaves no keys for entries on a %s", device.Name)
+	}
+	return keys, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// Address returns the host:port of the target
+func (t OscTarget) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// String formats the target as host:port, prefixed with the transport when
+// it is not UDP, e.g. tcp-slip://10.0.0.5:9000
+func (t OscTarget) String() string {
+	if t.Transport == "" || t.Transport == osc.UDP {
+		return t.Address()
+	}
+	return string(t.Transport) + "://" + t.Address()
+}
+
+// Validate checks that the target has a host and a usable port
+func (t OscTarget) Validate() error {
+	if t.Host == "" {
+		return errors.New("osc target host cannot be empty")
+	}
+	if t.Port < 1 || t.Port > 65535 {
+		return fmt.Errorf("osc target port %d is out of range", t.Port)
+	}
+	_, err := osc.ParseTransport(string(t.Transport))
+	return err
+}
+
+// ParseOscTargets parses a comma separated list of host:port pairs. A bare
+// host uses the default port and a transport:// prefix selects TCP framing.
+func ParseOscTargets(text string) ([]OscTarget, error) {
+	var targets []OscTarget
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		target := OscTarget{Port: DefaultOscPort}
+		if transport, rest, ok := strings.Cut(field, "://"); ok {
+			target.Transport = osc.Transport(transport)
+			field = rest
+		}
+		target.Host = field
+		if host, port, err := net.SplitHostPort(field); err == nil {
+			target.Host = host
+			target.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in %q", field)
+			}
+		}
+		if err := target.Validate(); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("at least one osc target is required")
+	}
+	return targets, nil
+}
+
+// FormatOscTargets is the inverse of ParseOscTargets
+func FormatOscTargets(targets []OscTarget) string {
+	parts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		parts = append(parts, target.String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// TemplateData is what OSC templates are executed against. Index is the
+// 1-based position of the file in the folder, PaddedIndex the same with the
+// option's zero padding and Base the option's ArgumentBase. Ext is the file
+// extension without the dot and Folder the name of the parent folder.
+type TemplateData struct {
+	Title       string
+	Slug        string
+	FullPath    string
+	Ext         string
+	MediaType   string
+	Folder      string
+	Prefix      string
+	PaddedIndex string
+	Index       int
+	Base        int
+}
+
+// sampleTemplateData is used to trial-run templates when a config is loaded
+var sampleTemplateData = TemplateData{
+	Title:       "Sample Clip",
+	Slug:        "sample-clip",
+	FullPath:    "/media/show/Sample Clip.mp4",
+	Ext:         "mp4",
+	MediaType:   "video",
+	Folder:      "show",
+	Prefix:      "/streamdeck",
+	PaddedIndex: "01",
+	Index:       1,
+	Base:        1,
+}
+
+var templateFuncs = template.FuncMap{
+	"pad":   func(width, n int) string { return fmt.Sprintf("%0*d", width, n) },
+	"slug":  Slugify,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// ParseTemplate parses an OSC argument or address template
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// Slugify lowercases a title and joins its words with dashes, so it can be
+// used inside an OSC address
+func Slugify(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return sb.String()
+}
+
+// Validate checks every OSC prefix option of the config
+func (c *Config) Validate() error {
+	for _, opt := range c.OscPrefixOptions {
+		if err := opt.Validate(); err != nil {
+			return fmt.Errorf("osc prefix option %q: %v", opt.Name, err)
+		}
+	}
+	for _, device := range c.DeviceProfiles {
+		if err := device.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.TabletLayout != (TabletLayout{}) {
+		if err := c.TabletLayout.Validate(); err != nil {
+			return err
+		}
+	}
+	return c.PageLayout.Validate()
+}
+
+// Validate parses the templates of an option and runs them against sample
+// data, so unknown fields and bad addresses are reported up front
+func (o OscPrefixOption) Validate() error {
+	if o.IndexPadding < 0 {
+		return errors.New("index padding cannot be negative")
+	}
+	if o.BundleDelay < 0 {
+		return errors.New("bundle delay cannot be negative")
+	}
+
+	for _, target := range o.OscTargets() {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.AddressTemplate != "" {
+		if err := validateAddress(o.AddressTemplate); err != nil {
+			return err
+		}
+	}
+	if err := validateArguments(o.Arguments); err != nil {
+		return err
+	}
+
+	for i, cmd := range o.Commands {
+		if err := validateCommand(cmd); err != nil {
+			return fmt.Errorf("command %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func validateCommand(cmd OscCommandTemplate) error {
+	if cmd.Address == "" {
+		return errors.New("address cannot be empty")
+	}
+	if cmd.Delay < 0 {
+		return errors.New("delay cannot be negative")
+	}
+	for _, target := range cmd.Targets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateAddress(cmd.Address); err != nil {
+		return err
+	}
+	return validateArguments(cmd.Arguments)
+}
+
+func validateAddress(text string) error {
+	tmpl, err := ParseTemplate("address", text)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, sampleTemplateData); err != nil {
+		return err
+	}
+	return CheckOscAddress(sb.String())
+}
+
+func validateArguments(args []OscArgumentSpec) error {
+	for i, arg := range args {
+		switch arg.Type {
+		case OscIntArg, OscFloatArg, OscStringArg, OscBoolArg:
+		default:
+			return fmt.Errorf("argument %d: unknown type %q", i+1, arg.Type)
+		}
+		tmpl, err := ParseTemplate(fmt.Sprintf("argument %d", i+1), arg.Template)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(&strings.Builder{}, sampleTemplateData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckOscAddress reports whether a rendered address is a valid OSC address
+func CheckOscAddress(address string) error {
+	if !strings.HasPrefix(address, "/") {
+		return fmt.Errorf("address %q must start with /", address)
+	}
+	if strings.ContainsAny(address, " #*,?[]{}") {
+		return fmt.Errorf("address %q contains characters not allowed in OSC addresses", address)
+	}
+	return nil
+}
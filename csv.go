@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// utf8BOM starts UTF-8 files saved by Excel and other spreadsheets
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// csvColumns are the columns of the CSV export. There is one row per OSC
+// command, with the entry columns repeated, and a single row for entries
+// without commands. osc_args is a JSON array and delay_ms the pause before
+// the command.
+var csvColumns = []string{
+	"entry", "title", "full_path",
+	"osc_path", "osc_host", "osc_port", "osc_transport", "osc_type_tags", "osc_args", "delay_ms",
+}
+
+const csvName = "media_config.csv"
+
+// csvExporter writes the entries for editing in a spreadsheet
+type csvExporter struct{}
+
+func (csvExporter) Name() string      { return "csv" }
+func (csvExporter) Extension() string { return ".csv" }
+
+func (csvExporter) Export(media MediaConfig, outDir string) (string, error) {
+	return exportFile(filepath.Join(outDir, csvName), func(w io.Writer) error {
+		return writeMediaCSV(w, &media)
+	})
+}
+
+// writeMediaCSV writes one row per OSC command. The entry column numbers
+// the entries from 1, which ties the rows back to them on import.
+func writeMediaCSV(w io.Writer, media *MediaConfig) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for i, entry := range media.Files {
+		row := []string{strconv.Itoa(i + 1), entry.Title, entry.FullPath}
+		if len(entry.OscCommands) == 0 {
+			if err := writer.Write(append(row, "", "", "", "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for c, cmd := range entry.OscCommands {
+			args, err := json.Marshal(cmd.OscValue)
+			if err != nil {
+				return fmt.Errorf("%s: %v", entry.Title, err)
+			}
+			port := ""
+			if cmd.OscPort != 0 {
+				port = strconv.Itoa(cmd.OscPort)
+			}
+			delay := ""
+			if d := entryDelay(entry, c); d != 0 {
+				delay = strconv.Itoa(d)
+			}
+			cells := append(append([]string{}, row...),
+				cmd.OscPath, cmd.OscHost, port, string(cmd.OscTransport), cmd.OscTypeTags, string(args), delay)
+			if err := writer.Write(cells); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvError is a problem with one cell of the CSV
+type csvError struct {
+	Column string
+	Err    error
+	Line   int
+	Field  int
+}
+
+func (e csvError) Error() string {
+	return fmt.Sprintf("line %d, column %d (%s): %v", e.Line, e.Field+1, e.Column, e.Err)
+}
+
+// readMediaCSV applies an edited CSV to the entries it was exported from.
+// Entries take the order of their first row, entries without rows are
+// dropped, and the fields the CSV does not hold, like the generated images,
+// the scripts and the bundle settings, are kept. All problems are reported
+// together, each with its line and column. The byte order mark spreadsheets
+// put in front of UTF-8 files is skipped.
+func readMediaCSV(r io.Reader, media *MediaConfig) (*MediaConfig, error) { // nolint:cyclop
+	buffered := bufio.NewReader(r)
+	if start, _ := buffered.Peek(len(utf8BOM)); bytes.Equal(start, utf8BOM) {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var missing []string
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("line 1: missing columns %s", strings.Join(missing, ", "))
+	}
+
+	var errs []error
+	var order []int
+	edited := map[int]*MediaEntry{}
+	delays := map[int][]int{}
+	titleLine := map[int]int{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cell := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		fail := func(name string, err error) {
+			line, _ := reader.FieldPos(0)
+			if i := columns[name]; i < len(record) {
+				line, _ = reader.FieldPos(i)
+			}
+			errs = append(errs, csvError{Line: line, Field: columns[name], Column: name, Err: err})
+		}
+
+		// Blank rows are left over from spreadsheet editing
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		index, err := strconv.Atoi(cell("entry"))
+		if err != nil || index < 1 || index > len(media.Files) {
+			fail("entry", fmt.Errorf("%q is not an entry number from 1 to %d", cell("entry"), len(media.Files)))
+			continue
+		}
+
+		entry, seen := edited[index]
+		if !seen {
+			original := media.Files[index-1]
+			entry = &original
+			// Reordered entries no longer sit at their recorded keys
+			entry.Page, entry.Position = 0, 0
+			entry.Title = cell("title")
+			entry.FullPath = cell("full_path")
+			entry.OscCommands = []OscCommand{}
+			edited[index] = entry
+			order = append(order, index)
+			line, _ := reader.FieldPos(columns["title"])
+			titleLine[index] = line
+		} else {
+			// The entry columns of later rows may be left blank
+			if title := cell("title"); title != "" && title != entry.Title {
+				fail("title", fmt.Errorf("entry %d is titled %q on line %d", index, entry.Title, titleLine[index]))
+			}
+			if path := cell("full_path"); path != "" && path != entry.FullPath {
+				fail("full_path", fmt.Errorf("entry %d has the path %q on line %d", index, entry.FullPath, titleLine[index]))
+			}
+		}
+
+		if cell("osc_path") == "" {
+			continue
+		}
+		cmd, delay, ok := csvOscCommand(cell, fail)
+		if !ok {
+			continue
+		}
+		entry.OscCommands = append(entry.OscCommands, cmd)
+		delays[index] = append(delays[index], delay)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	result := &MediaConfig{OscRoot: media.OscRoot, Files: make([]MediaEntry, 0, len(order)), OscArg: make([]string, 0, len(order))}
+	for _, index := range order {
+		entry := edited[index]
+		original := media.Files[index-1]
+
+		// The delays of the scripts follow those of the commands
+		entry.Delays = delays[index]
+		if len(original.Delays) > len(original.OscCommands) {
+			entry.Delays = append(entry.Delays, original.Delays[len(original.OscCommands):]...)
+		}
+		if entry.Delays == nil {
+			entry.Delays = []int{}
+		}
+
+		result.Files = append(result.Files, *entry)
+		result.OscArg = append(result.OscArg, entry.FullPath)
+	}
+	return result, nil
+}
+
+// csvOscCommand reads the OSC columns of a row, reporting each bad cell
+func csvOscCommand(cell func(string) string, fail func(string, error)) (OscCommand, int, bool) {
+	ok := true
+	cmd := OscCommand{OscPath: cell("osc_path"), OscHost: cell("osc_host"), OscTypeTags: cell("osc_type_tags")}
+
+	if !strings.HasPrefix(cmd.OscPath, "/") {
+		fail("osc_path", fmt.Errorf("address %q must start with /", cmd.OscPath))
+		ok = false
+	}
+	if port := cell("osc_port"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			fail("osc_port", fmt.Errorf("%q is not a port from 1 to 65535", port))
+			ok = false
+		}
+		cmd.OscPort = n
+	}
+
+	cmd.OscTransport = osc.UDP
+	if transport := cell("osc_transport"); transport != "" {
+		parsed, err := osc.ParseTransport(transport)
+		if err != nil {
+			fail("osc_transport", err)
+			ok = false
+		}
+		cmd.OscTransport = parsed
+	}
+
+	cmd.OscValue = []any{}
+	if args := cell("osc_args"); args != "" {
+		if err := json.Unmarshal([]byte(args), &cmd.OscValue); err != nil {
+			fail("osc_args", fmt.Errorf("arguments must be a JSON array like [1, \"text\"]: %v", err))
+			return cmd, 0, false
+		}
+	}
+	if ok {
+		// Check the values against the type tags as they would be sent
+		if _, err := oscMessage(cmd); err != nil {
+			column := "osc_args"
+			if cmd.OscTypeTags != "" && len(cmd.OscTypeTags) != len(cmd.OscValue) {
+				column = "osc_type_tags"
+			}
+			fail(column, err)
+			ok = false
+		}
+	}
+
+	delay := 0
+	if text := cell("delay_ms"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			fail("delay_ms", fmt.Errorf("%q is not a delay in milliseconds", text))
+			ok = false
+		}
+		delay = n
+	}
+	return cmd, delay, ok
+}
+
+// exportCSVCmd writes the entries of a prepared folder as CSV
+func exportCSVCmd(args []string) int {
+	fs := flag.NewFlagSet("export-csv", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write (default: "+csvName+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck export-csv [flags] <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, csvName)
+	}
+	if _, err := exportFile(path, func(w io.Writer) error { return writeMediaCSV(w, media) }); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d entries saved to %s\n", len(media.Files), path)
+	return 0
+}
+
+// relayoutImport lays the imported entries out again on the pages of the
+// device the original config was laid out for. The navigation keys keep
+// their places and icons; when the entries now need icons that were never
+// drawn, they are left without pages.
+func relayoutImport(edited, original *MediaConfig, devices []config.DeviceProfile, layout config.PageLayout) error {
+	device, err := findDeviceProfile(devices, original.Device)
+	if err != nil {
+		return err
+	}
+	keys, err := layout.Keys(device)
+	if err != nil {
+		return err
+	}
+
+	icons := map[string][2]string{}
+	if len(original.Navigation) > 0 {
+		keys = config.NavigationKeys{Previous: -1, Home: -1, Next: -1}
+		for _, nav := range original.Navigation {
+			switch nav.Action {
+			case navPrevious:
+				keys.Previous = nav.Position - 1
+			case navHome:
+				keys.Home = nav.Position - 1
+			case navNext:
+				keys.Next = nav.Position - 1
+			}
+			icons[nav.Action] = [2]string{nav.Image, nav.ImagePressed}
+		}
+	}
+
+	arrangePages(edited, device, keys)
+	for i, nav := range edited.Navigation {
+		names, ok := icons[nav.Action]
+		if !ok {
+			edited.Device, edited.Navigation = "", nil
+			for j := range edited.Files {
+				edited.Files[j].Page, edited.Files[j].Position = 0, 0
+			}
+			return fmt.Errorf("the entries no longer fit on one page of a %s", device.Name)
+		}
+		edited.Navigation[i].Image, edited.Navigation[i].ImagePressed = names[0], names[1]
+	}
+	return nil
+}
+
+// importCSVCmd applies an edited CSV to the media config it was exported from
+func importCSVCmd(args []string) int {
+	fs := flag.NewFlagSet("import-csv", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only check the CSV, do not rewrite the config")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck import-csv [flags] <csv> <config>")
+		fmt.Fprintln(fs.Output(), "<config> is the media_config.json the CSV was exported from, or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening CSV: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	edited, err := readMediaCSV(file, media)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not valid:\n%v\n", fs.Arg(0), err)
+		return 1
+	}
+	if *dryRun {
+		fmt.Printf("%s is valid: %d entries\n", fs.Arg(0), len(edited.Files))
+		return 0
+	}
+
+	if media.Device != "" {
+		cfg, err := loadConfigIfPresent()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := relayoutImport(edited, media, cfg.Devices(), cfg.PageLayout); err != nil {
+			fmt.Printf("Warning: the pages were not laid out again: %v. Run layout to place the entries\n", err)
+		}
+	}
+
+	path, err := jsonExporter{}.Export(*edited, dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%d entries saved to %s\n", len(edited.Files), path)
+	return 0
+}
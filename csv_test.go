@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// pagedMedia lays out count entries on a Stream Deck Mini with its default
+// navigation keys and icons
+func pagedMedia(t *testing.T, count int) (*MediaConfig, config.DeviceProfile) {
+	t.Helper()
+	device := config.DefaultDeviceProfiles[1]
+	keys, err := config.PageLayout{}.Keys(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media := &MediaConfig{}
+	for i := 1; i <= count; i++ {
+		media.Files = append(media.Files, MediaEntry{
+			Title:       fmt.Sprintf("Clip %d", i),
+			FullPath:    fmt.Sprintf("/show/clip%d.png", i),
+			OscCommands: []OscCommand{{OscPath: fmt.Sprintf("/clip/%d", i)}},
+			Delays:      []int{0},
+		})
+	}
+	arrangePages(media, device, keys)
+	for i, nav := range media.Navigation {
+		media.Navigation[i].Image = "nav_" + nav.Action + ".png"
+		media.Navigation[i].ImagePressed = "nav_" + nav.Action + "_pressed.png"
+	}
+	return media, device
+}
+
+// reorderedCSV exports the entries and reads them back in the given order,
+// with entries left out of it dropped
+func reorderedCSV(t *testing.T, media *MediaConfig, order ...int) *MediaConfig {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeMediaCSV(&buf, media); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every entry has one command, so row i+1 belongs to entry i
+	edited := [][]string{records[0]}
+	for _, index := range order {
+		edited = append(edited, records[index])
+	}
+	buf.Reset()
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(edited); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := readMediaCSV(&buf, media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func titles(media *MediaConfig) []string {
+	var out []string
+	for _, entry := range media.Files {
+		out = append(out, entry.Title)
+	}
+	return out
+}
+
+func TestImportCSVRelayoutsPages(t *testing.T) {
+	media, device := pagedMedia(t, 8)
+	edited := reorderedCSV(t, media, 8, 7, 6, 5, 4, 3, 2, 1)
+
+	if err := relayoutImport(edited, media, config.DefaultDeviceProfiles, config.PageLayout{}); err != nil {
+		t.Fatal(err)
+	}
+	if edited.Device != device.Name {
+		t.Errorf("device is %q, want %q", edited.Device, device.Name)
+	}
+	if len(edited.Navigation) != len(media.Navigation) {
+		t.Fatalf("%d navigation keys, want %d", len(edited.Navigation), len(media.Navigation))
+	}
+	for i, nav := range edited.Navigation {
+		if nav != media.Navigation[i] {
+			t.Errorf("navigation key %d is %+v, want %+v", i+1, nav, media.Navigation[i])
+		}
+	}
+
+	// The entries take the keys in their new order
+	pages := deckPages(edited, device)
+	var placed []string
+	for _, page := range pages {
+		for _, held := range page {
+			if held.Entry >= 0 {
+				placed = append(placed, edited.Files[held.Entry].Title)
+			}
+		}
+	}
+	want := []string{"Clip 8", "Clip 7", "Clip 6", "Clip 5", "Clip 4", "Clip 3", "Clip 2", "Clip 1"}
+	if !slices.Equal(placed, want) {
+		t.Errorf("keys hold %q, want %q", placed, want)
+	}
+	if first := edited.Files[0]; first.Page != 1 || first.Position != 1 {
+		t.Errorf("first entry is on page %d at %d, want page 1 at 1", first.Page, first.Position)
+	}
+}
+
+func TestImportCSVFitsOnOnePage(t *testing.T) {
+	media, device := pagedMedia(t, 8)
+	edited := reorderedCSV(t, media, 3, 1, 2)
+
+	if err := relayoutImport(edited, media, config.DefaultDeviceProfiles, config.PageLayout{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Navigation) != 0 {
+		t.Errorf("%d navigation keys left on a single page", len(edited.Navigation))
+	}
+	if got := titles(edited); !slices.Equal(got, []string{"Clip 3", "Clip 1", "Clip 2"}) {
+		t.Errorf("entries are %q", got)
+	}
+	for i, entry := range edited.Files {
+		if entry.Page != 1 || entry.Position != i+1 {
+			t.Errorf("%s is on page %d at %d, want page 1 at %d", entry.Title, entry.Page, entry.Position, i+1)
+		}
+	}
+	if len(deckPages(edited, device)) != 1 {
+		t.Error("entries are not on one page")
+	}
+}
+
+func TestImportCSVUnknownDevice(t *testing.T) {
+	media, _ := pagedMedia(t, 8)
+	edited := reorderedCSV(t, media, 2, 1)
+
+	devices := []config.DeviceProfile{config.DefaultDeviceProfiles[2]}
+	if err := relayoutImport(edited, media, devices, config.PageLayout{}); err == nil {
+		t.Fatal("laid out for a device that is not configured")
+	}
+	// The recorded keys of the old order must not survive the import
+	if edited.Device != "" || len(edited.Navigation) != 0 {
+		t.Errorf("import kept device %q and %d navigation keys", edited.Device, len(edited.Navigation))
+	}
+	for _, entry := range edited.Files {
+		if entry.Page != 0 || entry.Position != 0 {
+			t.Errorf("%s kept page %d at %d", entry.Title, entry.Page, entry.Position)
+		}
+	}
+}
+
+func TestImportCSVByteOrderMark(t *testing.T) {
+	media, _ := pagedMedia(t, 2)
+	var buf bytes.Buffer
+	if err := writeMediaCSV(&buf, media); err != nil {
+		t.Fatal(err)
+	}
+	header, rows, _ := strings.Cut(buf.String(), "\n")
+	first, rest, _ := strings.Cut(header, ",")
+
+	tests := map[string]string{
+		"plain":  "\ufeff" + buf.String(),
+		"quoted": "\ufeff\"" + first + "\"," + rest + "\n" + rows,
+	}
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := readMediaCSV(strings.NewReader(text), media)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(result); !slices.Equal(got, titles(media)) {
+				t.Errorf("entries are %q, want %q", got, titles(media))
+			}
+		})
+	}
+}
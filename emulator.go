@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/disintegration/imaging"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+const (
+	// emulatorKeyColumns is the width of a key in terminal columns. Keys are
+	// square, so they take half as many rows.
+	emulatorKeyColumns = 14
+	// emulatorMinPress keeps the pressed image visible for actions that
+	// finish instantly
+	emulatorMinPress = 150 * time.Millisecond
+)
+
+// emulatorKey holds the rendered images of one entry
+type emulatorKey struct {
+	normal  string
+	pressed string
+}
+
+// emulatorDoneMsg reports that the actions of a pressed key have finished
+type emulatorDoneMsg struct {
+	err     error
+	index   int
+	steps   int
+	elapsed time.Duration
+}
+
+// emulatorModel shows a prepared folder as the key grid of a Stream Deck
+type emulatorModel struct {
+	pathInput    textinput.Model
+	err          error
+	media        *MediaConfig
+	clients      *oscClients
+	pressed      map[int]bool
+	titleStyle   lipgloss.Style
+	promptStyle  lipgloss.Style
+	errorStyle   lipgloss.Style
+	detailStyle  lipgloss.Style
+	status       string
+	dir          string
+	keys         []emulatorKey
+	navKeys      map[string]emulatorKey
+	layout       [][]deckKey
+	devices      []config.DeviceProfile
+	device       config.DeviceProfile
+	step         int
+	deviceIdx    int
+	cursor       int
+	page         int
+	statusFailed bool
+}
+
+func initialEmulatorModel() emulatorModel {
+	cfg, err := config.LoadConfig()
+	var configErr error
+	if err != nil {
+		configErr = fmt.Errorf("error loading config: %v", err)
+		cfg = &config.DefaultConfig
+	}
+
+	pathInput := textinput.New()
+	pathInput.Placeholder = "Path to a prepared folder or its " + mediaConfigName
+	pathInput.SetValue(".")
+	pathInput.Focus()
+
+	return emulatorModel{
+		pathInput:   pathInput,
+		err:         configErr,
+		devices:     cfg.Devices(),
+		clients:     newOscClients(),
+		pressed:     map[int]bool{},
+		titleStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true),
+		promptStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")),
+		errorStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")),
+		detailStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("#0000FF")),
+	}
+}
+
+func (m emulatorModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m emulatorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case emulatorDoneMsg:
+		delete(m.pressed, msg.index)
+		title := m.media.Files[msg.index].Title
+		if msg.err != nil {
+			m.status = fmt.Sprintf("%s: %v", title, msg.err)
+			m.statusFailed = true
+		} else {
+			m.status = fmt.Sprintf("%s: %d actions run in %s", title, msg.steps, msg.elapsed.Round(time.Millisecond))
+			m.statusFailed = false
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			if m.step == 2 {
+				// Connections of the deck are not reused from the menu
+				m.clients.close()
+				return initialMainMenuModel(), nil
+			}
+			return m, tea.Quit
+		case tea.KeyEnter:
+			return m.handleEnter()
+		}
+
+		if m.step == 1 {
+			switch msg.Type {
+			case tea.KeyUp:
+				m.deviceIdx = (m.deviceIdx - 1 + len(m.devices)) % len(m.devices)
+			case tea.KeyDown:
+				m.deviceIdx = (m.deviceIdx + 1) % len(m.devices)
+			}
+			return m, nil
+		}
+		if m.step == 2 {
+			return m.handleDeckKey(msg)
+		}
+	}
+
+	if m.step == 0 {
+		m.pathInput, cmd = m.pathInput.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m emulatorModel) handleEnter() (tea.Model, tea.Cmd) {
+	switch m.step {
+	case 0: // Load the prepared folder
+		media, dir, err := loadMediaConfig(strings.TrimSpace(m.pathInput.Value()))
+		if err != nil {
+			m.err = fmt.Errorf("error loading media config: %v", err)
+			return m, nil
+		}
+		if len(media.Files) == 0 {
+			m.err = errors.New("the media config has no entries")
+			return m, nil
+		}
+		m.media = media
+		m.dir = dir
+		m.keys = make([]emulatorKey, len(media.Files))
+		for i, entry := range media.Files {
+			m.keys[i] = emulatorKey{
+				normal:  renderKeyImage(dir, entry.Image),
+				pressed: renderKeyImage(dir, entry.ImagePressed),
+			}
+		}
+		m.navKeys = map[string]emulatorKey{}
+		for _, nav := range media.Navigation {
+			if _, ok := m.navKeys[nav.Action]; !ok {
+				m.navKeys[nav.Action] = emulatorKey{
+					normal:  renderKeyImage(dir, nav.Image),
+					pressed: renderKeyImage(dir, nav.ImagePressed),
+				}
+			}
+		}
+		m.pathInput.Blur()
+		m.step++
+		return m, nil
+
+	case 1: // Device profile
+		m.device = m.devices[m.deviceIdx]
+		m.layout = deckPages(m.media, m.device)
+		m.step++
+		return m, nil
+
+	case 2: // Press the selected key
+		return m.press()
+	}
+	return m, nil
+}
+
+// handleDeckKey moves the cursor over the keys of the current page and
+// switches pages
+func (m emulatorModel) handleDeckKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	row, col := m.cursor/m.device.Cols, m.cursor%m.device.Cols
+
+	switch msg.Type {
+	case tea.KeyUp:
+		row = (row - 1 + m.device.Rows) % m.device.Rows
+	case tea.KeyDown:
+		row = (row + 1) % m.device.Rows
+	case tea.KeyLeft:
+		col = (col - 1 + m.device.Cols) % m.device.Cols
+	case tea.KeyRight:
+		col = (col + 1) % m.device.Cols
+	case tea.KeyPgUp:
+		m.page = (m.page - 1 + m.pages()) % m.pages()
+	case tea.KeyPgDown:
+		m.page = (m.page + 1) % m.pages()
+	case tea.KeySpace:
+		return m.press()
+	}
+
+	m.cursor = row*m.device.Cols + col
+	return m, nil
+}
+
+// press shows the pressed image of the selected key and runs its actions
+// in the background. Navigation keys switch to their page.
+func (m emulatorModel) press() (tea.Model, tea.Cmd) {
+	held := m.layout[m.page][m.cursor]
+	if held.Nav != nil {
+		m.page = held.Nav.Target - 1
+		return m, nil
+	}
+	index := held.Entry
+	if index < 0 || m.pressed[index] {
+		return m, nil
+	}
+	m.pressed[index] = true
+	entry := m.media.Files[index]
+	opts := runOptions{Clients: m.clients, Dir: m.dir, Index: index}
+
+	return m, func() tea.Msg {
+		start := time.Now()
+		result := runEntry(context.Background(), entry, opts)
+		elapsed := time.Since(start)
+		if elapsed < emulatorMinPress {
+			time.Sleep(emulatorMinPress - elapsed)
+		}
+		return emulatorDoneMsg{index: index, err: result.err(), steps: len(result.Steps), elapsed: elapsed}
+	}
+}
+
+func (m emulatorModel) pages() int {
+	return len(m.layout)
+}
+
+func (m emulatorModel) View() string {
+	if m.err != nil {
+		return m.errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
+	}
+
+	s := m.titleStyle.Render("StreamDeck Emulator") + "\n\n"
+
+	switch m.step {
+	case 0:
+		s += m.promptStyle.Render("Enter the prepared folder or "+mediaConfigName+":") + "\n"
+		s += m.pathInput.View()
+
+	case 1:
+		s += m.promptStyle.Render("Select device:") + "\n"
+		for i, device := range m.devices {
+			cursor := " "
+			if m.deviceIdx == i {
+				cursor = ">"
+			}
+			s += fmt.Sprintf("%s %s (%dx%d)\n", cursor, device.Name, device.Cols, device.Rows)
+		}
+
+	case 2:
+		s += m.promptStyle.Render(fmt.Sprintf("%s, page %d of %d (arrows to move, Enter to press, PgUp/PgDn for pages, Esc for menu)",
+			m.device.Name, m.page+1, m.pages())) + "\n"
+		s += m.deckView() + "\n"
+
+		held := m.layout[m.page][m.cursor]
+		if held.Nav != nil {
+			s += m.detailStyle.Render(held.Nav.describe()) + "\n"
+		} else if held.Entry >= 0 {
+			s += m.detailStyle.Render(fmt.Sprintf("%s (%s)", m.media.Files[held.Entry].Title, describeEntryOsc(m.media.Files[held.Entry]))) + "\n"
+		}
+		if m.statusFailed {
+			s += m.errorStyle.Render(m.status)
+		} else {
+			s += m.promptStyle.Render(m.status)
+		}
+	}
+
+	return s
+}
+
+// deckView renders the keys of the current page in device order
+func (m emulatorModel) deckView() string {
+	blank := renderHalfBlocks(imaging.New(emulatorKeyColumns, emulatorKeyColumns, color.NRGBA{A: 255}), emulatorKeyColumns)
+
+	rows := make([]string, 0, m.device.Rows)
+	for row := 0; row < m.device.Rows; row++ {
+		cells := make([]string, 0, m.device.Cols)
+		for col := 0; col < m.device.Cols; col++ {
+			slot := row*m.device.Cols + col
+			held := m.layout[m.page][slot]
+
+			img, title := blank, ""
+			if held.Nav != nil {
+				img, title = m.navKeys[held.Nav.Action].normal, held.Nav.describe()
+			} else if index := held.Entry; index >= 0 {
+				img, title = m.keys[index].normal, m.media.Files[index].Title
+				if m.pressed[index] {
+					img = m.keys[index].pressed
+				}
+			}
+
+			borderColor := lipgloss.Color("#444444")
+			if slot == m.cursor {
+				borderColor = lipgloss.Color("#00FF00")
+			}
+			cell := strings.TrimSuffix(img, "\n") + "\n" + fitTitle(title, emulatorKeyColumns)
+			cells = append(cells, lipgloss.NewStyle().
+				Border(lipgloss.RoundedBorder()).
+				BorderForeground(borderColor).
+				Render(cell))
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, cells...))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
+
+// renderKeyImage draws a key image centred on a black square key. Entries
+// without an image, such as audio files, get a dark grey key.
+func renderKeyImage(dir, name string) string {
+	size := ThumbWidth
+
+	var img image.Image
+	if name != "" {
+		if loaded, err := imaging.Open(filepath.Join(dir, name)); err == nil {
+			img = imaging.Fit(loaded, size, size, imaging.Box)
+		}
+	}
+	if img == nil {
+		return renderHalfBlocks(imaging.New(size, size, color.NRGBA{R: 48, G: 48, B: 48, A: 255}), emulatorKeyColumns)
+	}
+
+	key := imaging.PasteCenter(imaging.New(size, size, color.NRGBA{A: 255}), img)
+	return renderHalfBlocks(key, emulatorKeyColumns)
+}
+
+// fitTitle cuts or pads a title to exactly width columns
+func fitTitle(title string, width int) string {
+	runes := []rune(title)
+	if len(runes) > width {
+		runes = append(runes[:width-1], '…')
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// describeEntryOsc lists the OSC addresses of an entry for the status line
+func describeEntryOsc(entry MediaEntry) string {
+	if len(entry.OscCommands) == 0 {
+		return "no OSC commands"
+	}
+	addresses := make([]string, 0, len(entry.OscCommands))
+	for _, cmd := range entry.OscCommands {
+		addresses = append(addresses, fmt.Sprintf("%s -> %s", cmd.OscPath, oscTarget(cmd)))
+	}
+	return strings.Join(addresses, ", ")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	defaultJPEGQuality = 90
+	minJPEGQuality     = 10
+	jpegQualityStep    = 5
+)
+
+// checkOutputSettings validates the output settings before any file is written
+func checkOutputSettings(settings config.OutputSettings) error {
+	switch settings.Format {
+	case config.FormatSource, config.FormatPNG, config.FormatJPEG, config.FormatWebP:
+	default:
+		return fmt.Errorf("unknown output format %q", settings.Format)
+	}
+
+	if _, err := pngCompressionLevel(settings.PNGCompression); err != nil {
+		return err
+	}
+
+	// Configs written before the setting existed leave it at 0
+	if settings.JPEGQuality < 0 || settings.JPEGQuality > 100 {
+		return fmt.Errorf("jpeg quality must be between 1 and 100, or 0 for the default, got %d", settings.JPEGQuality)
+	}
+	if settings.MaxBytes < 0 {
+		return fmt.Errorf("maximum image size cannot be negative, got %d", settings.MaxBytes)
+	}
+
+	return nil
+}
+
+// outputExtension returns the extension generated images are written with,
+// using the given fallback when the settings keep the source format
+func outputExtension(settings config.OutputSettings, fallback string) string {
+	switch settings.Format {
+	case config.FormatPNG, config.FormatWebP:
+		// There is no WebP encoder available, so PNG is written instead
+		return ".png"
+	case config.FormatJPEG:
+		return ".jpg"
+	}
+	return fallback
+}
+
+// deckExtension maps a source image extension to one the Stream Deck accepts,
+// falling back to PNG for formats such as WebP, BMP and TIFF
+func deckExtension(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return ext
+	}
+	return ".png"
+}
+
+// hasAlphaChannel reports whether images written to the path can be
+// transparent
+func hasAlphaChannel(targetPath string) bool {
+	switch strings.ToLower(filepath.Ext(targetPath)) {
+	case ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// saveImage encodes an image according to the output settings and writes it.
+// When a size budget is set, JPEG quality is lowered step by step until the
+// image fits, PNG is compressed harder and then reduced to smaller palettes,
+// and GIF is reduced to the same palettes. Images that cannot be made small enough are still written and a
+// warning is printed.
+func saveImage(img image.Image, targetPath string, settings config.OutputSettings) error {
+	data, err := encodeImage(img, targetPath, settings)
+	if err != nil {
+		return err
+	}
+
+	if settings.MaxBytes > 0 && len(data) > settings.MaxBytes {
+		fmt.Printf("Warning: %s is %s, over the %s budget\n",
+			filepath.Base(targetPath),
+			formatFileSize(int64(len(data))),
+			formatFileSize(int64(settings.MaxBytes)),
+		)
+	}
+
+	return os.WriteFile(targetPath, data, 0644) // nolint:gosec
+}
+
+// encodeImage encodes an image in the format given by the target extension
+func encodeImage(img image.Image, targetPath string, settings config.OutputSettings) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch strings.ToLower(filepath.Ext(targetPath)) {
+	case ".jpg", ".jpeg":
+		quality := settings.JPEGQuality
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		for {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, fmt.Errorf("failed to encode jpeg: %v", err)
+			}
+			if settings.MaxBytes == 0 || buf.Len() <= settings.MaxBytes || quality <= minJPEGQuality {
+				return buf.Bytes(), nil
+			}
+			quality = max(quality-jpegQualityStep, minJPEGQuality)
+		}
+
+	case ".png":
+		level, err := pngCompressionLevel(settings.PNGCompression)
+		if err != nil {
+			return nil, err
+		}
+		encoder := png.Encoder{CompressionLevel: level}
+		if err := encoder.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %v", err)
+		}
+		if settings.MaxBytes == 0 || buf.Len() <= settings.MaxBytes {
+			return buf.Bytes(), nil
+		}
+
+		// Lossless output first gets compressed harder, then quantised to
+		// ever smaller palettes until it fits
+		encoder.CompressionLevel = png.BestCompression
+		candidates := []image.Image{img}
+		for _, levels := range pngPaletteLevels {
+			candidates = append(candidates, quantizeImage(img, levels))
+		}
+		for _, candidate := range candidates {
+			buf.Reset()
+			if err := encoder.Encode(&buf, candidate); err != nil {
+				return nil, fmt.Errorf("failed to encode png: %v", err)
+			}
+			if buf.Len() <= settings.MaxBytes {
+				break
+			}
+		}
+		return buf.Bytes(), nil
+
+	case ".gif":
+		if err := gif.Encode(&buf, img, nil); err != nil {
+			return nil, fmt.Errorf("failed to encode gif: %v", err)
+		}
+		if settings.MaxBytes == 0 || buf.Len() <= settings.MaxBytes {
+			return buf.Bytes(), nil
+		}
+		for _, levels := range pngPaletteLevels {
+			buf.Reset()
+			if err := gif.Encode(&buf, quantizeImage(img, levels), nil); err != nil {
+				return nil, fmt.Errorf("failed to encode gif: %v", err)
+			}
+			if buf.Len() <= settings.MaxBytes {
+				break
+			}
+		}
+		return buf.Bytes(), nil
+
+	default:
+		format, err := imaging.FormatFromFilename(targetPath)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported output format: %v", err)
+		}
+		if err := imaging.Encode(&buf, img, format); err != nil {
+			return nil, fmt.Errorf("failed to encode image: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// pngPaletteLevels are the shades per colour channel of the palettes PNG
+// and GIF output step down through to fit a size budget
+var pngPaletteLevels = []int{6, 4, 3, 2}
+
+// quantizeImage dithers an image to a palette with the given number of
+// evenly spaced shades per channel, plus transparency
+func quantizeImage(img image.Image, levels int) *image.Paletted {
+	pal := color.Palette{color.NRGBA{}}
+	for r := 0; r < levels; r++ {
+		for g := 0; g < levels; g++ {
+			for b := 0; b < levels; b++ {
+				shade := func(i int) uint8 { return uint8(i * 255 / (levels - 1)) }
+				pal = append(pal, color.NRGBA{R: shade(r), G: shade(g), B: shade(b), A: 255})
+			}
+		}
+	}
+
+	paletted := image.NewPaletted(img.Bounds(), pal)
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+	return paletted
+}
+
+// pngCompressionLevel maps the configured compression name to the encoder level
+func pngCompressionLevel(compression config.PNGCompression) (png.CompressionLevel, error) {
+	switch compression {
+	case config.PNGDefaultCompression, "":
+		return png.DefaultCompression, nil
+	case config.PNGNoCompression:
+		return png.NoCompression, nil
+	case config.PNGBestSpeed:
+		return png.BestSpeed, nil
+	case config.PNGBestCompression:
+		return png.BestCompression, nil
+	}
+	return png.DefaultCompression, fmt.Errorf("unknown png compression %q", compression)
+}
+
+// describeOutput summarises the output settings for the confirmation screen
+func describeOutput(settings config.OutputSettings) string {
+	format := string(settings.Format)
+	if settings.Format == config.FormatSource {
+		format = "same as source"
+	}
+	if settings.MaxBytes > 0 {
+		return fmt.Sprintf("%s (max %s per image)", format, formatFileSize(int64(settings.MaxBytes)))
+	}
+	return format
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// noisyImage is hard to compress, so size budgets have to step down
+func noisyImage(size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	seed := uint32(1)
+	for i := range img.Pix {
+		seed = seed*1664525 + 1013904223
+		img.Pix[i] = uint8(seed >> 24)
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+func TestEncodeImageBudgets(t *testing.T) {
+	img := noisyImage(96)
+
+	for _, ext := range []string{".jpg", ".png", ".gif"} {
+		t.Run(ext, func(t *testing.T) {
+			full, err := encodeImage(img, "key"+ext, config.OutputSettings{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			budget := len(full) / 2
+			fitted, err := encodeImage(img, "key"+ext, config.OutputSettings{MaxBytes: budget})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fitted) > budget {
+				t.Errorf("%d bytes, over the %d byte budget (%d without it)", len(fitted), budget, len(full))
+			}
+		})
+	}
+}
+
+func TestEncodeGIFPalette(t *testing.T) {
+	data, err := encodeImage(noisyImage(32), "key.gif", config.OutputSettings{MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An impossible budget ends at the smallest palette, nine colors padded
+	// to a power of two, which still decodes
+	decoded, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(decoded.ColorModel().(color.Palette)); n > 16 {
+		t.Errorf("palette has %d colors, want at most 16", n)
+	}
+}
+
+func TestJPEGQualityDefault(t *testing.T) {
+	img := noisyImage(32)
+	zero, err := encodeImage(img, "key.jpg", config.OutputSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := jpeg.Encode(&want, img, &jpeg.Options{Quality: defaultJPEGQuality}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(zero, want.Bytes()) {
+		t.Error("quality 0 does not encode at the default quality")
+	}
+
+	for _, quality := range []int{-1, 101} {
+		if err := checkOutputSettings(config.OutputSettings{Format: config.FormatSource, JPEGQuality: quality}); err == nil {
+			t.Errorf("quality %d was accepted", quality)
+		}
+	}
+}
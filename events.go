@@ -0,0 +1,273 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// eventBacklog is how many past events are kept for resuming clients
+	eventBacklog = 1000
+	// eventClientBuffer is how far a client may fall behind before it is
+	// dropped; it can reconnect and resume from its last sequence number
+	eventClientBuffer = 256
+	eventPingInterval = 30 * time.Second
+	eventWriteTimeout = 10 * time.Second
+)
+
+// Event types
+const (
+	eventEntryTriggered = "entry_triggered"
+	eventEntryFinished  = "entry_finished"
+	eventOscSent        = "osc_sent"
+	eventOscFailed      = "osc_failed"
+	eventScriptFinished = "script_finished"
+	// eventMissed tells a resuming client that events it asked for are no
+	// longer kept. It has no Seq of its own; NextSeq is the first one still
+	// available.
+	eventMissed = "events_missed"
+)
+
+// event is one change pushed to the WebSocket clients. Seq increases by one
+// per event, so clients can resume where they left off. Only events_missed
+// has Seq 0 and a NextSeq.
+type event struct {
+	Time     time.Time   `json:"time"`
+	Step     *stepResult `json:"step,omitempty"`
+	Type     string      `json:"type"`
+	Config   string      `json:"config,omitempty"`
+	Title    string      `json:"title,omitempty"`
+	FullPath string      `json:"full_path,omitempty"`
+	Seq      uint64      `json:"seq"`
+	NextSeq  uint64      `json:"next_seq,omitempty"`
+	Index    int         `json:"index,omitempty"`
+	Duration int64       `json:"duration_ms,omitempty"`
+	OK       bool        `json:"ok"`
+}
+
+// eventBus numbers events, keeps a backlog of them and fans them out to the
+// subscribed clients
+type eventBus struct {
+	clients map[chan event]struct{}
+	backlog []event
+	seq     uint64
+	mu      sync.Mutex
+	closed  bool
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{clients: map[chan event]struct{}{}}
+}
+
+// publish numbers an event and sends it to every client. Clients that are
+// too far behind are disconnected rather than slowing the others down.
+func (b *eventBus) publish(ev event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	ev.Seq = b.seq
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.backlog = append(b.backlog, ev)
+	if len(b.backlog) > eventBacklog {
+		b.backlog = b.backlog[len(b.backlog)-eventBacklog:]
+	}
+
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a client and returns the events after the sequence
+// number since, so nothing is lost between the backlog and live events.
+// since 0 means live events only.
+func (b *eventBus) subscribe(since uint64) (chan event, []event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan event, eventClientBuffer)
+	if b.closed {
+		close(ch)
+		return ch, nil
+	}
+	b.clients[ch] = struct{}{}
+
+	if since == 0 || since == b.seq {
+		return ch, nil
+	}
+
+	// A client ahead of the bus saw the events of an earlier run of the
+	// server, so everything kept now is new to it
+	if since > b.seq {
+		first := b.seq + 1
+		if len(b.backlog) > 0 {
+			first = b.backlog[0].Seq
+		}
+		replay := []event{{Type: eventMissed, NextSeq: first, Time: time.Now()}}
+		return ch, append(replay, b.backlog...)
+	}
+
+	var replay []event
+	if len(b.backlog) > 0 && b.backlog[0].Seq > since+1 {
+		replay = append(replay, event{Type: eventMissed, NextSeq: b.backlog[0].Seq, Time: time.Now()})
+	}
+	for _, ev := range b.backlog {
+		if ev.Seq > since {
+			replay = append(replay, ev)
+		}
+	}
+	return ch, replay
+}
+
+func (b *eventBus) unsubscribe(ch chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.clients[ch]; ok {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// close disconnects all clients, used when the server shuts down
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// stepEvent describes a finished step of an entry
+func stepEvent(base event, step stepResult) event {
+	ev := base
+	ev.Step = &step
+	ev.Duration = step.Duration
+	ev.OK = step.Error == ""
+	switch step.Kind {
+	case stepOsc, stepOscBundle:
+		ev.Type = eventOscSent
+		if !ev.OK {
+			ev.Type = eventOscFailed
+		}
+	default:
+		ev.Type = eventScriptFinished
+	}
+	return ev
+}
+
+// checkEventOrigin lets browsers open the event stream from pages served by
+// the server itself or by localhost, and from the origins allowed with
+// --allow-origin. Requests without an Origin do not come from a browser.
+func (s *mediaServer) checkEventOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	if !s.servesHost(r.Host) {
+		return false
+	}
+	if sameOrigin(origin, r.Host) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return strings.EqualFold(u.Hostname(), "localhost") || ip != nil && ip.IsLoopback()
+}
+
+// handleEvents streams events over a WebSocket. A client resuming after a
+// disconnect passes the last sequence number it saw as ?since=.
+func (s *mediaServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if value := r.URL.Query().Get("since"); value != "" {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be a sequence number")
+			return
+		}
+		since = n
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkEventOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	ch, replay := s.events.subscribe(since)
+	defer s.events.unsubscribe(ch)
+
+	// Read until the client goes away; it has nothing to say
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(ev event) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(ev) == nil
+	}
+
+	for _, ev := range replay {
+		if !write(ev) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(eventPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				// Dropped for falling behind, or the server is stopping
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+				return
+			}
+			if !write(ev) {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
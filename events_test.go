@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// seqs lists the types and sequence numbers of replayed events, with the
+// next available one for events_missed
+func seqs(events []event) []string {
+	var out []string
+	for _, ev := range events {
+		if ev.Type == eventMissed {
+			out = append(out, fmt.Sprintf("%s@%d>%d", ev.Type, ev.Seq, ev.NextSeq))
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s@%d", ev.Type, ev.Seq))
+	}
+	return out
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	bus := newEventBus()
+	for i := 0; i < 3; i++ {
+		bus.publish(event{Type: eventEntryTriggered})
+	}
+
+	tests := map[string]struct {
+		since uint64
+		want  []string
+	}{
+		"live only":  {since: 0, want: nil},
+		"up to date": {since: 3, want: nil},
+		"behind":     {since: 1, want: []string{"entry_triggered@2", "entry_triggered@3"}},
+		// After a restart the client's numbering belongs to the old server
+		"ahead": {since: 7, want: []string{"events_missed@0>1", "entry_triggered@1", "entry_triggered@2", "entry_triggered@3"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ch, replay := bus.subscribe(tt.since)
+			defer bus.unsubscribe(ch)
+			if got := seqs(replay); !slices.Equal(got, tt.want) {
+				t.Errorf("replayed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeAheadOfEmptyBus(t *testing.T) {
+	bus := newEventBus()
+	ch, replay := bus.subscribe(5)
+	defer bus.unsubscribe(ch)
+	if got, want := seqs(replay), []string{"events_missed@0>1"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+}
+
+func TestSubscribeBacklogOverflow(t *testing.T) {
+	bus := newEventBus()
+	for i := 0; i < eventBacklog+5; i++ {
+		bus.publish(event{Type: eventOscSent})
+	}
+	ch, replay := bus.subscribe(2)
+	defer bus.unsubscribe(ch)
+
+	if len(replay) != eventBacklog+1 {
+		t.Fatalf("replayed %d events, want %d", len(replay), eventBacklog+1)
+	}
+	if got := seqs(replay[:2]); !slices.Equal(got, []string{"events_missed@0>6", "osc_sent@6"}) {
+		t.Errorf("replay starts with %q, want events_missed before osc_sent@6", got)
+	}
+}
+
+func TestCheckEventOrigin(t *testing.T) {
+	tests := map[string]struct {
+		host    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		"no origin":        {host: "127.0.0.1:8765", want: true},
+		"same origin":      {host: "127.0.0.1:8765", origin: "http://127.0.0.1:8765", want: true},
+		"localhost page":   {host: "127.0.0.1:8765", origin: "http://localhost:3000", want: true},
+		"loopback page":    {host: "localhost:8765", origin: "http://127.0.0.1:5173", want: true},
+		"foreign page":     {host: "127.0.0.1:8765", origin: "https://attacker.example"},
+		"rebound domain":   {host: "attacker.example:8765", origin: "http://attacker.example:8765"},
+		"local file":       {host: "127.0.0.1:8765", origin: "null"},
+		"allowed file":     {host: "127.0.0.1:8765", origin: "null", allowed: []string{"null"}, want: true},
+		"allowed page":     {host: "127.0.0.1:8765", origin: "https://dash.example", allowed: []string{"https://dash.example"}, want: true},
+		"any origin":       {host: "127.0.0.1:8765", origin: "https://attacker.example", allowed: []string{"*"}, want: true},
+		"other allowed":    {host: "127.0.0.1:8765", origin: "https://attacker.example", allowed: []string{"https://dash.example"}},
+		"non http origins": {host: "127.0.0.1:8765", origin: "chrome-extension://abc"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(defaultServeAddr)
+			s.allowedOrigins = tt.allowed
+			req := httptest.NewRequest(http.MethodGet, "/api/events", http.NoBody)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := s.checkEventOrigin(req); got != tt.want {
+				t.Errorf("checkEventOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// Exporter writes prepared entries in one output format
+type Exporter interface {
+	// Name identifies the format, as given to --format
+	Name() string
+	// Extension is the extension of the file the format is written to
+	Extension() string
+	// Export writes the entries to a file in outDir, the folder their images
+	// are in, and returns the path of the file
+	Export(media MediaConfig, outDir string) (string, error)
+}
+
+// exporterRegistry lists the output formats in the order they are offered,
+// starting with the media_config.json the other commands read
+type exporterRegistry []Exporter
+
+// newExporterRegistry sets up every output format with its settings from
+// the config, followed by the templates of the templates folder
+func newExporterRegistry(cfg *config.Config) exporterRegistry {
+	openStage, touchOSC := openStageExporter, touchOSCExporter
+	openStage.layout = cfg.Layout()
+	touchOSC.layout = cfg.Layout()
+
+	registry := exporterRegistry{
+		jsonExporter{},
+		profileExporter{devices: cfg.Devices(), settings: cfg.StreamDeckProfile},
+		companionExporter{},
+		openStage,
+		touchOSC,
+		galleryExporter{devices: cfg.Devices()},
+		csvExporter{},
+	}
+	return append(registry, templateExporters(cfg.Templates())...)
+}
+
+// find looks an exporter up by name, ignoring case
+func (r exporterRegistry) find(name string) (Exporter, error) {
+	for _, exporter := range r {
+		if strings.EqualFold(exporter.Name(), name) {
+			return exporter, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q, choose from: %s", name, strings.Join(r.names(), ", "))
+}
+
+func (r exporterRegistry) names() []string {
+	names := make([]string, 0, len(r))
+	for _, exporter := range r {
+		names = append(names, exporter.Name())
+	}
+	return names
+}
+
+// exportName is the base name of the files exported to a folder: the name
+// of the folder itself
+func exportName(outDir string) string {
+	if abs, err := filepath.Abs(outDir); err == nil {
+		return filepath.Base(abs)
+	}
+	return filepath.Base(outDir)
+}
+
+// exportFile creates a file and writes an export to it, removing the file
+// again if writing fails part way
+func exportFile(path string, write func(w io.Writer) error) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// jsonExporter writes the media_config.json that the deck and the other
+// commands read
+type jsonExporter struct{}
+
+func (jsonExporter) Name() string      { return "json" }
+func (jsonExporter) Extension() string { return ".json" }
+
+func (jsonExporter) Export(media MediaConfig, outDir string) (string, error) {
+	jsonData, err := json.MarshalIndent(media, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("error creating JSON: %v", err)
+	}
+
+	jsonPath := filepath.Join(outDir, mediaConfigName)
+	if err := os.WriteFile(jsonPath, jsonData, 0644); err != nil { // nolint:gosec
+		return "", fmt.Errorf("error saving JSON file: %v", err)
+	}
+	return jsonPath, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// templateExtension marks the files of the templates folder that are
+// offered as output formats
+const templateExtension = ".tmpl"
+
+// templateExporter renders a user template against the MediaConfig. The
+// output and the format are named after the template without .tmpl, so
+// "show.xml.tmpl" is "template:show.xml" and writes "show.xml".
+type templateExporter struct {
+	path string
+}
+
+func (e templateExporter) Name() string {
+	// The extension stays, so show.xml and show.json are different formats
+	return "template:" + e.output()
+}
+
+func (e templateExporter) Extension() string {
+	return filepath.Ext(e.output())
+}
+
+func (e templateExporter) output() string {
+	return strings.TrimSuffix(filepath.Base(e.path), templateExtension)
+}
+
+func (e templateExporter) Export(media MediaConfig, outDir string) (string, error) {
+	tmpl, err := parseExportTemplate(e.path, outDir)
+	if err != nil {
+		return "", err
+	}
+	return exportFile(filepath.Join(outDir, e.output()), func(w io.Writer) error {
+		return tmpl.Execute(w, media)
+	})
+}
+
+// templateExporters returns an exporter for every template in a folder, in
+// name order. A missing folder has no templates.
+func templateExporters(dir string) []Exporter {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: cannot read the templates folder: %v\n", err)
+		}
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	var exporters []Exporter
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != templateExtension {
+			continue
+		}
+		exporters = append(exporters, templateExporter{path: filepath.Join(dir, file.Name())})
+	}
+	return exporters
+}
+
+// parseExportTemplate reads a template with the helper functions. Paths
+// given to the image helpers are relative to dir, where the images are.
+func parseExportTemplate(path, dir string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(exportTemplateFuncs(dir)).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// exportTemplateFuncs are the helpers available to output templates:
+//
+//	json v           v as JSON, strings quoted
+//	jsonEscape s     s escaped for use inside JSON quotes
+//	xmlEscape s      s escaped for XML text and attributes
+//	base p, dir p    the last element of a path, and the rest
+//	ext p, stem p    the extension of a path, and its base without it
+//	slash p          p with forward slashes
+//	abs p            p made absolute against the output folder
+//	base64Image p    the image file p base64 encoded
+//	dataURL p        the image file p as a data: URL
+//	pad n v          v zero padded to n digits
+//	add a b          a + b, for 1-based numbering
+func exportTemplateFuncs(dir string) template.FuncMap {
+	readImage := func(name string) ([]byte, error) {
+		if name == "" {
+			return nil, nil
+		}
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, name)
+		}
+		return os.ReadFile(path)
+	}
+
+	return template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"jsonEscape": func(s string) string {
+			data, _ := json.Marshal(s)
+			return string(data[1 : len(data)-1])
+		},
+		"xmlEscape": func(s string) string {
+			var sb strings.Builder
+			_ = xml.EscapeText(&sb, []byte(s))
+			return sb.String()
+		},
+		"base":  filepath.Base,
+		"dir":   filepath.Dir,
+		"ext":   filepath.Ext,
+		"slash": filepath.ToSlash,
+		"stem": func(p string) string {
+			return strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		},
+		"abs": func(p string) string {
+			if filepath.IsAbs(p) {
+				return p
+			}
+			if abs, err := filepath.Abs(filepath.Join(dir, p)); err == nil {
+				return abs
+			}
+			return filepath.Join(dir, p)
+		},
+		"base64Image": func(name string) (string, error) {
+			data, err := readImage(name)
+			return base64.StdEncoding.EncodeToString(data), err
+		},
+		"dataURL": func(name string) (string, error) {
+			data, err := readImage(name)
+			if err != nil || data == nil {
+				return "", err
+			}
+			mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+			if mimeType == "" {
+				mimeType = "application/octet-stream"
+			}
+			return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+		},
+		"pad": func(width int, v any) string {
+			return fmt.Sprintf("%0*v", width, v)
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
+	}
+}
+
+// exportTemplateCmd renders any template file against a prepared folder
+func exportTemplateCmd(args []string) int {
+	fs := flag.NewFlagSet("export-template", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write (default: the template name without "+templateExtension+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck export-template [flags] <template> <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+
+	exporter := templateExporter{path: fs.Arg(0)}
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, exporter.output())
+	}
+	tmpl, err := parseExportTemplate(exporter.path, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading template: %v\n", err)
+		return 1
+	}
+	if _, err := exportFile(path, func(w io.Writer) error { return tmpl.Execute(w, media) }); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering template: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Rendered %d entries to %s\n", len(media.Files), path)
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestExportTemplateFuncs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "key.png"), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{name: "pad int", text: `{{pad 3 .}}`, data: 7, want: "007"},
+		{name: "pad wider value", text: `{{pad 2 .}}`, data: 1234, want: "1234"},
+		{name: "pad string", text: `{{pad 4 .}}`, data: "12", want: "0012"},
+		{name: "jsonEscape", text: `{{jsonEscape .}}`, data: "say \"hi\"\n\\ <b>", want: `say \"hi\"\n\\ \u003cb\u003e`},
+		{name: "jsonEscape empty", text: `{{jsonEscape .}}`, data: "", want: ""},
+		{name: "dataURL", text: `{{dataURL .}}`, data: "key.png", want: "data:image/png;base64,cG5n"},
+		{name: "dataURL absolute", text: `{{dataURL .}}`, data: filepath.Join(dir, "key.png"), want: "data:image/png;base64,cG5n"},
+		{name: "dataURL no image", text: `{{dataURL .}}`, data: "", want: ""},
+		{name: "dataURL missing", text: `{{dataURL .}}`, data: "gone.png", wantErr: true},
+		{name: "abs relative", text: `{{abs .}}`, data: "key.png", want: filepath.Join(absDir, "key.png")},
+		{name: "abs parent", text: `{{abs .}}`, data: filepath.Join("..", "other.png"), want: filepath.Join(filepath.Dir(absDir), "other.png")},
+		{name: "abs absolute", text: `{{abs .}}`, data: filepath.Join(absDir, "x", "y.png"), want: filepath.Join(absDir, "x", "y.png")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New(tt.name).Funcs(exportTemplateFuncs(dir)).Parse(tt.text))
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("rendered %q, want an error", sb.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sb.String() != tt.want {
+				t.Errorf("rendered %q, want %q", sb.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateExporterNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"show.xml.tmpl", "show.json.tmpl", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	for _, exporter := range templateExporters(dir) {
+		names = append(names, exporter.Name()+" "+exporter.Extension())
+	}
+	if got, want := strings.Join(names, ", "), "template:show.json .json, template:show.xml .xml"; got != want {
+		t.Errorf("exporters are %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+const galleryName = "gallery.html"
+
+// galleryData is what the gallery template renders
+type galleryData struct {
+	Generated time.Time
+	Title     string
+	Device    config.DeviceProfile
+	Pages     []galleryPage
+	Entries   int
+	Warnings  int
+}
+
+// galleryPage is one screen of keys in device order, padded with empty keys
+type galleryPage struct {
+	Keys   []galleryKey
+	Number int
+}
+
+// galleryKey is one key of the gallery. Image URLs are relative to the page.
+// Navigation keys switch pages and have no entry.
+type galleryKey struct {
+	Title        string
+	Image        string
+	ImagePressed string
+	FullPath     string
+	Commands     []galleryCommand
+	Scripts      []string
+	Warnings     []string
+	Index        int
+	Empty        bool
+	Navigation   bool
+}
+
+// galleryCommand is an OSC command formatted for reading
+type galleryCommand struct {
+	Address   string
+	Target    string
+	Arguments string
+	Delay     int
+}
+
+// galleryCmd writes the gallery of a prepared folder as a static HTML page
+func galleryCmd(args []string) int {
+	fs := flag.NewFlagSet("gallery", flag.ContinueOnError)
+	deviceName := fs.String("device", "", "device profile to lay the keys out for (default: the one the pages are laid out for, or the first one)")
+	out := fs.String("out", "", "file to write (default: "+galleryName+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck gallery [flags] <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	device, err := mediaDeviceProfile(cfg.Devices(), media, *deviceName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, galleryName)
+	}
+	// Image links are relative to wherever the page is written
+	base, err := filepath.Rel(filepath.Dir(path), dir)
+	if err != nil {
+		base = dir
+	}
+	imageURL := func(name string) string {
+		return relativeURL(filepath.Join(base, name))
+	}
+
+	data := buildGallery(media, dir, device, imageURL)
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating gallery: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	if err := writeGallery(file, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing gallery: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Gallery of %d entries with %d warnings saved to %s\n", data.Entries, data.Warnings, path)
+	return 0
+}
+
+// relativeURL turns a relative file path into a URL path, escaping every
+// segment so names with #, ? or % still load
+func relativeURL(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// buildGallery lays the entries out on the pages of a device. imageURL turns
+// an image name from the config into the URL the page loads it from.
+func buildGallery(media *MediaConfig, dir string, device config.DeviceProfile, imageURL func(name string) string) galleryData {
+	data := galleryData{
+		Generated: time.Now(),
+		Title:     filepath.Base(dir),
+		Device:    device,
+		Entries:   len(media.Files),
+	}
+
+	titles := map[string]int{}
+	for _, entry := range media.Files {
+		titles[strings.ToLower(entry.Title)]++
+	}
+
+	for p, keys := range deckPages(media, device) {
+		page := galleryPage{Number: p + 1}
+		for _, held := range keys {
+			if nav := held.Nav; nav != nil {
+				key := galleryKey{Title: nav.describe(), Navigation: true}
+				if nav.Image != "" {
+					key.Image = imageURL(nav.Image)
+				}
+				if nav.ImagePressed != "" {
+					key.ImagePressed = imageURL(nav.ImagePressed)
+				}
+				page.Keys = append(page.Keys, key)
+				continue
+			}
+			if held.Entry < 0 {
+				page.Keys = append(page.Keys, galleryKey{Empty: true})
+				continue
+			}
+
+			entry := media.Files[held.Entry]
+			key := galleryKey{
+				Title:    entry.Title,
+				FullPath: entry.FullPath,
+				Index:    held.Entry + 1,
+				Warnings: entryWarnings(entry, dir, titles),
+			}
+			if entry.Image != "" {
+				key.Image = imageURL(entry.Image)
+			}
+			if entry.ImagePressed != "" {
+				key.ImagePressed = imageURL(entry.ImagePressed)
+			}
+			for i, cmd := range entry.OscCommands {
+				key.Commands = append(key.Commands, galleryCommand{
+					Address:   cmd.OscPath,
+					Target:    oscTarget(cmd).String(),
+					Arguments: formatOscArguments(cmd),
+					Delay:     entryDelay(entry, i),
+				})
+			}
+			key.Scripts = append(append(key.Scripts, entry.Scripts...), entry.ScriptPaths...)
+
+			data.Warnings += len(key.Warnings)
+			page.Keys = append(page.Keys, key)
+		}
+		data.Pages = append(data.Pages, page)
+	}
+
+	return data
+}
+
+// entryWarnings lists the problems a director should know about before
+// signing off a key
+func entryWarnings(entry MediaEntry, dir string, titles map[string]int) []string {
+	var warnings []string
+
+	if entry.Title == "" {
+		warnings = append(warnings, "no title")
+	} else if titles[strings.ToLower(entry.Title)] > 1 {
+		warnings = append(warnings, "title is used by several entries")
+	}
+
+	// Audio entries are prepared without images
+	audio := slices.Contains(audioExtensions, strings.ToLower(filepath.Ext(entry.FullPath)))
+	for _, image := range []struct{ label, name string }{{"image", entry.Image}, {"pressed image", entry.ImagePressed}} {
+		if image.name == "" {
+			if !audio {
+				warnings = append(warnings, "no "+image.label)
+			}
+		} else if _, err := os.Stat(filepath.Join(dir, image.name)); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s %s is missing", image.label, image.name))
+		}
+	}
+
+	if len(entry.OscCommands) == 0 && len(entry.Scripts) == 0 && len(entry.ScriptPaths) == 0 {
+		warnings = append(warnings, "pressing the key does nothing")
+	}
+	for _, cmd := range entry.OscCommands {
+		if _, err := oscMessage(cmd); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	steps := len(entry.OscCommands) + len(entry.Scripts) + len(entry.ScriptPaths)
+	if len(entry.Delays) > steps {
+		warnings = append(warnings, fmt.Sprintf("%d delays for %d steps", len(entry.Delays), steps))
+	}
+
+	return warnings
+}
+
+// formatOscArguments shows the values of a command with their type tags
+func formatOscArguments(cmd OscCommand) string {
+	args := make([]string, 0, len(cmd.OscValue))
+	for i, value := range cmd.OscValue {
+		text := fmt.Sprint(value)
+		if s, ok := value.(string); ok {
+			text = fmt.Sprintf("%q", s)
+		}
+		if i < len(cmd.OscTypeTags) {
+			text = string(cmd.OscTypeTags[i]) + ":" + text
+		}
+		args = append(args, text)
+	}
+	return strings.Join(args, ", ")
+}
+
+func writeGallery(w io.Writer, data galleryData) error {
+	return galleryTemplate.Execute(w, data)
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - StreamDeck preview</title>
+<style>
+  body { background: #1b1b1b; color: #ddd; font-family: sans-serif; margin: 2em; }
+  h1 { margin-bottom: 0.2em; }
+  .summary { color: #999; margin-bottom: 2em; }
+  .grid { display: grid; grid-template-columns: repeat({{.Device.Cols}}, minmax(220px, 1fr)); gap: 12px; margin-bottom: 2em; }
+  .key { background: #2a2a2a; border-radius: 8px; padding: 10px; font-size: 12px; }
+  .key.empty { background: #222; border: 1px dashed #444; min-height: 120px; }
+  .key.warn { outline: 2px solid #d33; }
+  .key.nav { background: #1d2533; }
+  .images { display: flex; gap: 6px; }
+  .images figure { margin: 0; flex: 1; text-align: center; }
+  .images img, .noimage { width: 100%; aspect-ratio: 1; object-fit: contain; background: #000; border-radius: 6px; }
+  .noimage { display: flex; align-items: center; justify-content: center; color: #666; }
+  figcaption { color: #888; }
+  .title { font-size: 14px; font-weight: bold; margin: 8px 0 4px; }
+  .path { color: #888; word-break: break-all; }
+  ul { padding-left: 1.2em; margin: 4px 0; }
+  code { color: #9cf; }
+  .warnings { color: #f66; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="summary">{{.Entries}} entries on {{len .Pages}} page(s) of a {{.Device.Name}} ({{.Device.Cols}}x{{.Device.Rows}}),
+{{if .Warnings}}<span class="warnings">{{.Warnings}} warning(s)</span>{{else}}no warnings{{end}}.
+Generated {{.Generated.Format "2006-01-02 15:04"}}.</div>
+{{range .Pages}}
+<h2>Page {{.Number}}</h2>
+<div class="grid">
+{{- range .Keys}}
+{{- if .Empty}}
+  <div class="key empty"></div>
+{{- else}}
+  <div class="key{{if .Warnings}} warn{{end}}{{if .Navigation}} nav{{end}}">
+    <div class="images">
+      <figure>{{if .Image}}<img src="{{.Image}}" alt="{{.Title}}">{{else}}<div class="noimage">none</div>{{end}}<figcaption>normal</figcaption></figure>
+      <figure>{{if .ImagePressed}}<img src="{{.ImagePressed}}" alt="{{.Title}} pressed">{{else}}<div class="noimage">none</div>{{end}}<figcaption>pressed</figcaption></figure>
+    </div>
+    <div class="title">{{if .Index}}{{.Index}}. {{end}}{{.Title}}</div>
+    <div class="path">{{.FullPath}}</div>
+    {{- if .Commands}}
+    <ul>
+      {{- range .Commands}}
+      <li>{{if .Delay}}after {{.Delay}} ms: {{end}}<code>{{.Address}}</code> {{.Arguments}} &rarr; {{.Target}}</li>
+      {{- end}}
+    </ul>
+    {{- end}}
+    {{- if .Scripts}}
+    <ul>
+      {{- range .Scripts}}
+      <li>script: <code>{{.}}</code></li>
+      {{- end}}
+    </ul>
+    {{- end}}
+    {{- if .Warnings}}
+    <ul class="warnings">
+      {{- range .Warnings}}
+      <li>{{.}}</li>
+      {{- end}}
+    </ul>
+    {{- end}}
+  </div>
+{{- end}}
+{{- end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// galleryExporter writes the HTML preview of the keys
+type galleryExporter struct {
+	devices []config.DeviceProfile
+}
+
+func (galleryExporter) Name() string      { return "gallery" }
+func (galleryExporter) Extension() string { return ".html" }
+
+func (e galleryExporter) Export(media MediaConfig, outDir string) (string, error) {
+	device, err := mediaDeviceProfile(e.devices, &media, "")
+	if err != nil {
+		return "", err
+	}
+	data := buildGallery(&media, outDir, device, relativeURL)
+	return exportFile(filepath.Join(outDir, galleryName), func(w io.Writer) error {
+		return writeGallery(w, data)
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+func TestRelativeURL(t *testing.T) {
+	tests := map[string]string{
+		"clip_thumb.png":                     "clip_thumb.png",
+		filepath.Join("..", "show", "a.png"): "../show/a.png",
+		"Track #1_thumb.png":                 "Track%20%231_thumb.png",
+		"what?_thumb.png":                    "what%3F_thumb.png",
+		"100%_thumb.png":                     "100%25_thumb.png",
+	}
+	for path, want := range tests {
+		if got := relativeURL(path); got != want {
+			t.Errorf("relativeURL(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestEntryWarningsImages(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"clip_thumb.png", "clip_pressed.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	osc := []OscCommand{{OscPath: "/go"}}
+
+	tests := map[string]struct {
+		entry MediaEntry
+		want  []string
+	}{
+		"images": {
+			entry: MediaEntry{Title: "Clip", FullPath: "/show/clip.png", Image: "clip_thumb.png", ImagePressed: "clip_pressed.png", OscCommands: osc},
+		},
+		"audio": {
+			entry: MediaEntry{Title: "Song", FullPath: "/show/Song.MP3", OscCommands: osc},
+		},
+		"video without thumbnail": {
+			entry: MediaEntry{Title: "Clip", FullPath: "/show/clip.mp4", OscCommands: osc},
+			want:  []string{"no image", "no pressed image"},
+		},
+		"missing file": {
+			entry: MediaEntry{Title: "Clip", FullPath: "/show/clip.png", Image: "gone.png", ImagePressed: "clip_pressed.png", OscCommands: osc},
+			want:  []string{"image gone.png is missing"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			titles := map[string]int{strings.ToLower(tt.entry.Title): 1}
+			if got := entryWarnings(tt.entry, dir, titles); !slices.Equal(got, tt.want) {
+				t.Errorf("warnings %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServedGalleryImages checks that the links of the served gallery load
+// images whose names need escaping
+func TestServedGalleryImages(t *testing.T) {
+	dir := t.TempDir()
+	image, pressed := "Track #1?_thumb.png", "Track #1?_pressed.png"
+	for _, name := range []string{image, pressed} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("png"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestServer(defaultServeAddr)
+	s.configs[0].Dir = dir
+	s.configs[0].Media.Files[0].Image = image
+	s.configs[0].Media.Files[0].ImagePressed = pressed
+	s.devices = config.DefaultConfig.Devices()
+
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/gallery/show/", http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gallery status %d: %s", rec.Code, rec.Body.String())
+	}
+	link := relativeURL(image)
+	if !strings.Contains(rec.Body.String(), `src="`+link+`"`) {
+		t.Fatalf("gallery does not link %q", link)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/gallery/show/"+link, http.NoBody))
+	if rec.Code != http.StatusOK || rec.Body.String() != "png" {
+		t.Errorf("image status %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGalleryExportEscapesImages(t *testing.T) {
+	dir := t.TempDir()
+	image := "Track #1?_thumb.png"
+	if err := os.WriteFile(filepath.Join(dir, image), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	media := MediaConfig{Files: []MediaEntry{{Title: "Track", FullPath: "/show/Track #1?.png", Image: image}}}
+
+	path, err := galleryExporter{devices: config.DefaultDeviceProfiles}.Export(media, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := relativeURL(image); !strings.Contains(string(page), `src="`+link+`"`) {
+		t.Errorf("gallery does not link %q", link)
+	}
+}
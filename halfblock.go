@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/disintegration/imaging"
+)
+
+// renderHalfBlocks draws an image in the terminal with upper half-block
+// characters, so every text row shows two pixel rows. The image is scaled to
+// the given width in columns, keeping its aspect ratio.
+func renderHalfBlocks(img image.Image, columns int) string {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 || columns <= 0 {
+		return ""
+	}
+
+	rows := bounds.Dy() * columns / bounds.Dx()
+	if rows < 2 {
+		rows = 2
+	}
+	scaled := imaging.Resize(img, columns, rows, imaging.Box)
+
+	var sb strings.Builder
+	for y := 0; y+1 < rows; y += 2 {
+		for x := 0; x < columns; x++ {
+			top := scaled.NRGBAAt(x, y)
+			bottom := scaled.NRGBAAt(x, y+1)
+			sb.WriteString(lipgloss.NewStyle().
+				Foreground(lipgloss.Color(colorToHex(top))).
+				Background(lipgloss.Color(colorToHex(bottom))).
+				Render("▀"))
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// colorToHex formats a colour as #RRGGBB, blending transparency over black
+func colorToHex(c color.NRGBA) string {
+	blend := func(v uint8) uint8 {
+		return uint8(uint16(v) * uint16(c.A) / 255)
+	}
+	return fmt.Sprintf("#%02X%02X%02X", blend(c.R), blend(c.G), blend(c.B))
+}
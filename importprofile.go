@@ -0,0 +1,570 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// Actions of the Stream Deck app the importer understands
+const (
+	sdOpenAction    = "com.elgato.streamdeck.system.open"
+	sdWebsiteAction = "com.elgato.streamdeck.system.website"
+)
+
+// sdImportManifest is the top manifest of a profile. Profiles written by
+// version 2 of the app list their pages, older ones hold the actions of
+// their single page themselves.
+type sdImportManifest struct {
+	Actions map[string]sdAction `json:"Actions"`
+	Device  sdDevice            `json:"Device"`
+	Name    string              `json:"Name"`
+	Pages   sdPages             `json:"Pages"`
+}
+
+// sdImportPage is one page found in the archive. Image names in its actions
+// are relative to Dir.
+type sdImportPage struct {
+	Actions map[string]sdAction
+	Dir     string
+	// Encoders are the dial actions of a Stream Deck +
+	Encoders map[string]sdAction
+}
+
+// unsupportedAction is a key the importer could not turn into an entry
+type unsupportedAction struct {
+	Title  string
+	Name   string
+	UUID   string
+	Reason string
+	Key    string
+	Page   int
+}
+
+// importReport tells what became of the keys of a profile
+type importReport struct {
+	Unsupported []unsupportedAction
+	Keys        int
+	Imported    int
+}
+
+// importProfileCmd turns a .streamDeckProfile archive into a prepared folder
+func importProfileCmd(args []string) int {
+	fs := flag.NewFlagSet("import-profile", flag.ContinueOnError)
+	out := fs.String("out", "", "folder to write "+mediaConfigName+" and the key images to (default: the profile name next to the archive)")
+	reportPath := fs.String("report", "", "also write the report of unsupported actions to this file")
+	keep := fs.Bool("keep-unsupported", false, "keep keys with unsupported actions as entries with their title and image only")
+	force := fs.Bool("force", false, "overwrite an existing "+mediaConfigName)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck import-profile [flags] <profile>")
+		fmt.Fprintln(fs.Output(), "<profile> is a "+profileExtension+" archive.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	archivePath := fs.Arg(0)
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening profile: %v\n", err)
+		return 1
+	}
+	defer archive.Close()
+
+	dir := *out
+	if dir == "" {
+		dir = strings.TrimSuffix(archivePath, filepath.Ext(archivePath))
+	}
+	configPath := filepath.Join(dir, mediaConfigName)
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists, use --force to overwrite it\n", configPath)
+		return 1
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil { // nolint:gosec
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", dir, err)
+		return 1
+	}
+
+	media, report, err := importStreamDeckProfile(&archive.Reader, dir, *keep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing profile: %v\n", err)
+		return 1
+	}
+
+	jsonData, err := json.MarshalIndent(media, "", "    ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating JSON: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(configPath, jsonData, 0644); err != nil { // nolint:gosec
+		fmt.Fprintf(os.Stderr, "Error saving JSON file: %v\n", err)
+		return 1
+	}
+
+	report.write(os.Stdout)
+	if *reportPath != "" {
+		file, err := os.Create(*reportPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating report: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		report.write(file)
+	}
+
+	fmt.Printf("Configuration with %d entries saved to %s\n", len(media.Files), configPath)
+	return 0
+}
+
+// importStreamDeckProfile reads the keys of a profile archive page by page,
+// in row order, and extracts their images into dir. Keys whose action is not
+// recognised are reported, and kept without actions when keep is set.
+func importStreamDeckProfile(archive *zip.Reader, dir string, keep bool) (*MediaConfig, importReport, error) {
+	var report importReport
+
+	pages, err := readProfilePages(archive)
+	if err != nil {
+		return nil, report, err
+	}
+
+	media := &MediaConfig{Files: []MediaEntry{}, OscArg: []string{}}
+	for p, page := range pages {
+		for _, key := range sortedKeys(page.Encoders) {
+			action := page.Encoders[key]
+			report.Keys++
+			report.Unsupported = append(report.Unsupported, unsupportedAction{
+				Page: p + 1, Key: key, Title: actionTitle(action), Name: action.Name, UUID: action.UUID,
+				Reason: "dial actions are not supported",
+			})
+		}
+
+		for _, key := range sortedKeys(page.Actions) {
+			action := page.Actions[key]
+			report.Keys++
+
+			// Image names are made from the key, so it must be a position
+			col, row, ok := parseKey(key)
+			if !ok {
+				report.Unsupported = append(report.Unsupported, unsupportedAction{
+					Page: p + 1, Key: key, Title: actionTitle(action), Name: action.Name, UUID: action.UUID,
+					Reason: "key is not a column,row position",
+				})
+				continue
+			}
+
+			entry, err := importAction(action)
+			if err != nil {
+				report.Unsupported = append(report.Unsupported, unsupportedAction{
+					Page: p + 1, Key: key, Title: entry.Title, Name: action.Name, UUID: action.UUID,
+					Reason: err.Error(),
+				})
+				if !keep {
+					continue
+				}
+			} else {
+				report.Imported++
+			}
+
+			prefix := fmt.Sprintf("p%d_%d_%d", p+1, col, row)
+			entry.Image = extractStateImage(archive, page, key, action, 0, dir, prefix+"_thumb")
+			if len(action.States) > 1 {
+				entry.ImagePressed = extractStateImage(archive, page, key, action, 1, dir, prefix+"_pressed")
+			}
+
+			media.Files = append(media.Files, entry)
+			media.OscArg = append(media.OscArg, entry.FullPath)
+		}
+	}
+
+	return media, report, nil
+}
+
+// readProfilePages finds the pages of a profile in its archive, ordered as
+// the profile manifest lists them. Page folders the manifest does not name
+// follow in name order.
+func readProfilePages(archive *zip.Reader) ([]sdImportPage, error) {
+	var root string
+	var manifest sdImportManifest
+	found := false
+	for _, f := range archive.File {
+		name := f.Name
+		if path.Base(name) != "manifest.json" || strings.Contains(path.Dir(name), "/") {
+			continue
+		}
+		if err := readZipJSON(f, &manifest); err != nil {
+			return nil, err
+		}
+		root, found = path.Dir(name)+"/", true
+		break
+	}
+	if !found {
+		return nil, errors.New("no profile manifest in the archive")
+	}
+	if root == "./" {
+		root = ""
+	}
+
+	// Profiles from older versions of the app have a single page
+	if len(manifest.Actions) > 0 {
+		return []sdImportPage{{Actions: manifest.Actions, Dir: root}}, nil
+	}
+
+	order := map[string]int{}
+	for i, id := range manifest.Pages.Pages {
+		order[strings.ToLower(id)] = i
+	}
+
+	type namedPage struct {
+		sdImportPage
+		id string
+	}
+	var named []namedPage
+	for _, f := range archive.File {
+		rest, ok := strings.CutPrefix(f.Name, root+"Profiles/")
+		if !ok {
+			continue
+		}
+		id, file, _ := strings.Cut(rest, "/")
+		if file != "manifest.json" {
+			continue
+		}
+
+		var pageManifest sdPageManifest
+		if err := readZipJSON(f, &pageManifest); err != nil {
+			return nil, err
+		}
+		page := namedPage{id: strings.ToLower(id)}
+		page.Dir = root + "Profiles/" + id + "/"
+		for _, controller := range pageManifest.Controllers {
+			switch controller.Type {
+			case "Encoder":
+				page.Encoders = controller.Actions
+			default:
+				page.Actions = controller.Actions
+			}
+		}
+		named = append(named, page)
+	}
+
+	sort.SliceStable(named, func(i, j int) bool {
+		oi, iListed := order[named[i].id]
+		oj, jListed := order[named[j].id]
+		switch {
+		case iListed && jListed:
+			return oi < oj
+		case iListed != jListed:
+			return iListed
+		}
+		return named[i].id < named[j].id
+	})
+
+	pages := make([]sdImportPage, 0, len(named))
+	for _, page := range named {
+		pages = append(pages, page.sdImportPage)
+	}
+	return pages, nil
+}
+
+// importAction maps a recognised action to an entry. The returned entry
+// always carries the key's title, even with an error.
+func importAction(action sdAction) (MediaEntry, error) {
+	entry := MediaEntry{
+		Title:       actionTitle(action),
+		OscCommands: []OscCommand{},
+		Scripts:     []string{},
+		ScriptPaths: []string{},
+		Delays:      []int{},
+	}
+	settings := action.Settings
+
+	// Keys exported by this tool carry their commands as they were
+	if raw, ok := settings["osc_commands"]; ok {
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &entry.OscCommands); err != nil {
+			return entry, fmt.Errorf("invalid osc_commands: %v", err)
+		}
+		entry.FullPath = settingString(settings, "path")
+		return entry, nil
+	}
+
+	switch {
+	case action.UUID == sdOpenAction:
+		entry.FullPath = settingString(settings, "path")
+		if entry.FullPath == "" {
+			return entry, errors.New("no file to open")
+		}
+
+	case action.UUID == sdWebsiteAction:
+		entry.FullPath = settingString(settings, "path", "url")
+		if entry.FullPath == "" {
+			return entry, errors.New("no website address")
+		}
+
+	case strings.Contains(strings.ToLower(action.UUID), "osc"):
+		cmd, err := importOscSettings(settings)
+		if err != nil {
+			return entry, err
+		}
+		entry.OscCommands = append(entry.OscCommands, cmd)
+
+	default:
+		return entry, errors.New("action is not supported")
+	}
+	return entry, nil
+}
+
+// importOscSettings reads the command of an OSC plugin action. Plugins name
+// their settings differently, so the common spellings are tried in turn.
+func importOscSettings(settings map[string]any) (OscCommand, error) {
+	cmd := OscCommand{OscTransport: osc.UDP, OscValue: []any{}}
+
+	cmd.OscPath = settingString(settings, "address", "oscAddress", "osc_address", "path", "oscPath", "osc_path")
+	if !strings.HasPrefix(cmd.OscPath, "/") {
+		return cmd, errors.New("no OSC address in the action settings")
+	}
+	cmd.OscHost = settingString(settings, "host", "ip", "oscHost", "osc_host")
+	if port := settingString(settings, "port", "oscPort", "osc_port"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return cmd, fmt.Errorf("invalid OSC port %q", port)
+		}
+		cmd.OscPort = n
+	}
+
+	for _, key := range []string{"value", "values", "args", "arguments", "oscValue", "osc_value"} {
+		raw, ok := settings[key]
+		if !ok {
+			continue
+		}
+		values, isList := raw.([]any)
+		if !isList {
+			values = []any{raw}
+		}
+		for _, value := range values {
+			tag, converted, ok := importOscValue(value)
+			if !ok {
+				return cmd, fmt.Errorf("unsupported OSC value %v", value)
+			}
+			cmd.OscTypeTags += string(tag)
+			cmd.OscValue = append(cmd.OscValue, converted)
+		}
+		break
+	}
+	return cmd, nil
+}
+
+// importOscValue guesses the OSC type of a setting value. Plugins often keep
+// numbers as text, so strings that parse as numbers or booleans become them.
+func importOscValue(value any) (byte, any, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+			return 'i', int(v), true
+		}
+		return 'f', v, true
+	case bool:
+		if v {
+			return 'T', true, true
+		}
+		return 'F', false, true
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			return 'i', int(n), true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return 'f', f, true
+		}
+		switch strings.ToLower(v) {
+		case "true":
+			return 'T', true, true
+		case "false":
+			return 'F', false, true
+		}
+		return 's', v, true
+	}
+	return 0, nil, false
+}
+
+// extractStateImage copies the image of one state of a key out of the
+// archive and returns its name, or "" when the state has none
+func extractStateImage(archive *zip.Reader, page sdImportPage, key string, action sdAction, state int, dir, name string) string {
+	if state >= len(action.States) {
+		return ""
+	}
+	image := action.States[state].Image
+	if image == "" {
+		return ""
+	}
+
+	// Older profiles keep the images in a folder per key
+	candidates := []string{page.Dir + image, page.Dir + key + "/CustomImages/" + path.Base(image)}
+	for _, candidate := range candidates {
+		f := findZipFile(archive, candidate)
+		if f == nil {
+			continue
+		}
+		name += imageExtension(image)
+		target := filepath.Join(dir, name)
+		if rel, err := filepath.Rel(dir, target); err != nil || !filepath.IsLocal(rel) {
+			fmt.Printf("Warning: image of key %s would be written outside %s\n", key, dir)
+			return ""
+		}
+		if err := extractZipFile(f, target); err != nil {
+			fmt.Printf("Warning: could not extract the image of key %s: %v\n", key, err)
+			return ""
+		}
+		return name
+	}
+
+	fmt.Printf("Warning: image %s of key %s is missing from the archive\n", image, key)
+	return ""
+}
+
+// imageExtension is the lower case extension of an image in the archive,
+// or "" when it is anything but letters and digits
+func imageExtension(image string) string {
+	ext := strings.ToLower(path.Ext(image))
+	if len(ext) < 2 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// parseKey reads a "column,row" key of a page
+func parseKey(key string) (col, row int, ok bool) {
+	c, r, found := strings.Cut(key, ",")
+	if !found {
+		return 0, 0, false
+	}
+	col, errCol := strconv.Atoi(c)
+	row, errRow := strconv.Atoi(r)
+	if errCol != nil || errRow != nil || col < 0 || row < 0 {
+		return 0, 0, false
+	}
+	return col, row, true
+}
+
+// actionTitle is the title shown on a key, on one line
+func actionTitle(action sdAction) string {
+	title := ""
+	if len(action.States) > 0 {
+		state := action.States[0]
+		if action.State > 0 && action.State < len(action.States) {
+			state = action.States[action.State]
+		}
+		title = strings.Join(strings.Fields(state.Title), " ")
+	}
+	if title == "" {
+		title = action.Name
+	}
+	return title
+}
+
+// settingString returns the first of the given settings that is set, with
+// numbers formatted as text
+func settingString(settings map[string]any, keys ...string) string {
+	for _, key := range keys {
+		switch v := settings[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// sortedKeys orders "column,row" keys row by row
+func sortedKeys(actions map[string]sdAction) []string {
+	keys := make([]string, 0, len(actions))
+	for key := range actions {
+		keys = append(keys, key)
+	}
+	position := func(key string) (int, int) {
+		col, row, _ := parseKey(key)
+		return row, col
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, ci := position(keys[i])
+		rj, cj := position(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return ci < cj
+	})
+	return keys
+}
+
+func (r importReport) write(w io.Writer) {
+	fmt.Fprintf(w, "Imported %d of %d keys\n", r.Imported, r.Keys)
+	if len(r.Unsupported) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%d unsupported actions:\n", len(r.Unsupported))
+	for _, u := range r.Unsupported {
+		fmt.Fprintf(w, "  page %d, key %s %q: %s (%s): %s\n", u.Page, u.Key, u.Title, u.Name, u.UUID, u.Reason)
+	}
+}
+
+func findZipFile(archive *zip.Reader, name string) *zip.File {
+	for _, f := range archive.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func readZipJSON(f *zip.File, v any) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// readArchive opens an archive held in memory
+func readArchive(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestImportExportedProfile(t *testing.T) {
+	src := t.TempDir()
+	writeKeyImages(t, src, "intro_thumb.png", "loop_thumb.jpg")
+	media := &MediaConfig{Files: []MediaEntry{
+		{Title: "Intro", FullPath: "/show/intro.png", Image: "intro_thumb.png", OscCommands: []OscCommand{{OscPath: "/clip/1", OscHost: "10.0.0.5", OscPort: 7000}}},
+		{Title: "Loop", FullPath: "/show/loop.jpg", Image: "loop_thumb.jpg"},
+		{Title: "Song", FullPath: "/show/song.mp3"},
+		{Title: "Outro", FullPath: "/show/outro.png", OscCommands: []OscCommand{{OscPath: "/clip/4"}}},
+	}}
+	device := config.DefaultDeviceProfiles[1] // Stream Deck Mini, 3 columns
+
+	var buf bytes.Buffer
+	if err := exportStreamDeckProfile(&buf, media, src, "Show", device, config.StreamDeckProfileSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	imported, report, err := importStreamDeckProfile(readArchive(t, buf.Bytes()), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Keys != 4 || report.Imported != 4 || len(report.Unsupported) != 0 {
+		t.Errorf("report is %+v, want all 4 keys imported", report)
+	}
+	if got := titles(imported); !slices.Equal(got, titles(media)) {
+		t.Fatalf("entries are %q, want %q", got, titles(media))
+	}
+	want := []struct{ image, content string }{
+		{"p1_0_0_thumb.png", "intro_thumb.png"},
+		{"p1_1_0_thumb.jpg", "loop_thumb.jpg"},
+		{"", ""},
+		{"", ""},
+	}
+	for i, entry := range imported.Files {
+		if entry.FullPath != media.Files[i].FullPath {
+			t.Errorf("%s: path %q, want %q", entry.Title, entry.FullPath, media.Files[i].FullPath)
+		}
+		if len(entry.OscCommands) != len(media.Files[i].OscCommands) {
+			t.Errorf("%s: %d commands, want %d", entry.Title, len(entry.OscCommands), len(media.Files[i].OscCommands))
+		} else if len(entry.OscCommands) > 0 && entry.OscCommands[0].OscPath != media.Files[i].OscCommands[0].OscPath {
+			t.Errorf("%s: command %+v", entry.Title, entry.OscCommands[0])
+		}
+		if entry.Image != want[i].image {
+			t.Errorf("%s: image %q, want %q", entry.Title, entry.Image, want[i].image)
+			continue
+		}
+		if entry.Image == "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Image))
+		if err != nil || string(content) != want[i].content {
+			t.Errorf("%s: image holds %q (%v), want %q", entry.Title, content, err, want[i].content)
+		}
+	}
+}
+
+// TestImportProfileRejectsKeyPaths checks that keys and image names from a
+// crafted archive cannot place files outside the import folder
+func TestImportProfileRejectsKeyPaths(t *testing.T) {
+	state := []sdState{{Title: "Evil", Image: "Images/evil.p$g"}}
+	actions := map[string]sdAction{
+		"0,0":              {UUID: sdOpenAction, Settings: map[string]any{"path": "/show/a.png"}, States: []sdState{{Title: "Good", Image: "Images/good.png"}}},
+		"../../../escaped": {UUID: sdOpenAction, Settings: map[string]any{"path": "/show/b.png"}, States: state},
+		"1,../../x":        {UUID: sdOpenAction, Settings: map[string]any{"path": "/show/c.png"}, States: state},
+		"-1,0":             {UUID: sdOpenAction, Settings: map[string]any{"path": "/show/d.png"}, States: state},
+		"2,0":              {UUID: sdOpenAction, Settings: map[string]any{"path": "/show/e.png"}, States: state},
+	}
+	manifest, err := json.Marshal(sdImportManifest{Actions: actions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string][]byte{
+		"Show.sdProfile/manifest.json":   manifest,
+		"Show.sdProfile/Images/good.png": []byte("good"),
+		"Show.sdProfile/Images/evil.p$g": []byte("evil"),
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "show")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	media, report, err := importStreamDeckProfile(readArchive(t, buf.Bytes()), dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejected []string
+	for _, u := range report.Unsupported {
+		rejected = append(rejected, u.Key)
+	}
+	slices.Sort(rejected)
+	if want := []string{"-1,0", "../../../escaped", "1,../../x"}; !slices.Equal(rejected, want) {
+		t.Errorf("reported keys %q, want %q", rejected, want)
+	}
+	if got := titles(media); !slices.Equal(got, []string{"Good", "Evil"}) {
+		t.Errorf("entries are %q", got)
+	}
+	// The extension from the archive is dropped rather than trusted
+	if media.Files[0].Image != "p1_0_0_thumb.png" || media.Files[1].Image != "p1_2_0_thumb" {
+		t.Errorf("images are %q and %q", media.Files[0].Image, media.Files[1].Image)
+	}
+
+	var written []string
+	err = filepath.WalkDir(parent, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(parent, path)
+			written = append(written, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(written)
+	if want := []string{"show/p1_0_0_thumb.png", "show/p1_2_0_thumb"}; !slices.Equal(written, want) {
+		t.Errorf("files written %q, want %q", written, want)
+	}
+}
+
+func TestImageExtension(t *testing.T) {
+	tests := map[string]string{
+		"Images/a.PNG":      ".png",
+		"Images/a.jpeg":     ".jpeg",
+		"Images/a":          "",
+		"Images/a.":         "",
+		"Images/a.png/..":   "",
+		"Images/a.p\\..\\x": "",
+	}
+	for image, want := range tests {
+		if got := imageExtension(image); got != want {
+			t.Errorf("imageExtension(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
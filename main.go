@@ -21,6 +21,7 @@ func initialMainMenuModel() mainMenuModel {
 		choices: []string{
 			"Prepare Media Folder",
 			"Echo Command",
+			"Deck Emulator",
 			"Quit",
 		},
 		cursor:      0,
@@ -54,7 +55,9 @@ func (m mainMenuModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return initialModel(), nil
 			case 1: // Echo Command
 				return initialEchoModel(), nil
-			case 2: // Quit
+			case 2: // Deck Emulator
+				return initialEmulatorModel(), nil
+			case 3: // Quit
 				return m, tea.Quit
 			}
 		}
@@ -79,6 +82,10 @@ func (m mainMenuModel) View() string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runSubcommand(os.Args[1:]))
+	}
+
 	p := tea.NewProgram(initialMainMenuModel())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running program: %v", err)
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	tagImageDescription = 0x010E
+	tagOrientation      = 0x0112
+	tagXMLPacket        = 0x02BC
+	tiffTypeASCII       = 2
+	tiffTypeByte        = 1
+	tiffTypeShort       = 3
+	tiffTypeUndefined   = 7
+
+	// orientationTranspose is the first EXIF orientation that swaps the
+	// width and height of the stored image
+	orientationTranspose = 5
+
+	// maxMetadataScan limits how much of a non-JPEG file is searched for XMP
+	maxMetadataScan = 4 << 20
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpTitleRe = regexp.MustCompile(`(?s)<dc:title(?:\s[^>]*)?>(.*?)</dc:title>`)
+	xmpItemRe  = regexp.MustCompile(`(?s)<rdf:li(?:\s[^>]*)?>(.*?)</rdf:li>`)
+)
+
+// imageMetadata holds the descriptive fields read from an image file, and
+// its EXIF orientation from 1 to 8, or 0 when it has none
+type imageMetadata struct {
+	Description string
+	XMPTitle    string
+	Orientation int
+}
+
+// title returns the best title found in the metadata, or an empty string
+func (md imageMetadata) title() string {
+	if md.Description != "" {
+		return md.Description
+	}
+	return md.XMPTitle
+}
+
+// readImageMetadata reads the EXIF ImageDescription and XMP title of an image.
+// Missing or malformed metadata is not an error, the fields are left empty.
+func readImageMetadata(path string) (imageMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return imageMetadata{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMetadataScan))
+	if err != nil {
+		return imageMetadata{}, err
+	}
+
+	var md imageMetadata
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		md = readJPEGMetadata(data)
+	case bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")):
+		md = readTIFFMetadata(data)
+	}
+
+	// Other formats such as PNG and WebP keep XMP as plain text
+	if md.XMPTitle == "" {
+		md.XMPTitle = xmpTitle(data)
+	}
+
+	return md, nil
+}
+
+// readJPEGMetadata walks the JPEG segments up to the image data looking for
+// the EXIF and XMP APP1 segments
+func readJPEGMetadata(data []byte) imageMetadata {
+	var md imageMetadata
+
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan or end of image
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+
+		if marker == 0xE1 {
+			switch {
+			case bytes.HasPrefix(segment, exifHeader):
+				exif := readTIFFMetadata(segment[len(exifHeader):])
+				md.Description, md.Orientation = exif.Description, exif.Orientation
+			case bytes.HasPrefix(segment, xmpHeader):
+				md.XMPTitle = xmpTitle(segment[len(xmpHeader):])
+			}
+		}
+
+		pos += 2 + length
+	}
+
+	return md
+}
+
+// readTIFFMetadata reads the first IFD of a TIFF structure, which is how both
+// TIFF files and EXIF blocks store their tags
+func readTIFFMetadata(data []byte) imageMetadata {
+	var md imageMetadata
+	if len(data) < 8 {
+		return md
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return md
+	}
+
+	// Offsets and sizes are checked as unsigned 64-bit values before they
+	// become ints, which would turn large ones negative on 32-bit builds
+	length := uint64(len(data))
+	ifdOffset := uint64(order.Uint32(data[4:]))
+	if ifdOffset+2 > length {
+		return md
+	}
+	ifd := int(ifdOffset)
+	count := int(order.Uint16(data[ifd:]))
+
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		tag := order.Uint16(data[entry:])
+		kind := order.Uint16(data[entry+2:])
+		size := uint64(order.Uint32(data[entry+4:]))
+
+		// Values of up to four bytes are stored inline
+		value := data[entry+8 : entry+12]
+		if size > 4 {
+			offset := uint64(order.Uint32(data[entry+8:]))
+			if offset+size > length {
+				continue
+			}
+			value = data[int(offset):int(offset+size)]
+		} else {
+			value = value[:size]
+		}
+
+		switch {
+		case tag == tagOrientation && kind == tiffTypeShort && size == 1:
+			// A count of shorts, stored inline in the first two bytes
+			if o := int(order.Uint16(data[entry+8:])); o >= 1 && o <= 8 {
+				md.Orientation = o
+			}
+		case tag == tagImageDescription && kind == tiffTypeASCII:
+			md.Description = strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+		case tag == tagXMLPacket && (kind == tiffTypeByte || kind == tiffTypeUndefined):
+			md.XMPTitle = xmpTitle(value)
+		}
+	}
+
+	return md
+}
+
+// xmpTitle extracts the dc:title of an XMP packet, the first item of its
+// language alternatives, looking no further than the closing tag
+func xmpTitle(data []byte) string {
+	title := xmpTitleRe.FindSubmatch(data)
+	if title == nil {
+		return ""
+	}
+	item := xmpItemRe.FindSubmatch(title[1])
+	if item == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(string(item[1])))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tiffEntry is one IFD entry of a test TIFF structure. Values longer than
+// four bytes are stored after the IFD.
+type tiffEntry struct {
+	value []byte
+	tag   uint16
+	kind  uint16
+	count uint32
+}
+
+// buildTIFF lays out a little-endian TIFF header, one IFD and its values
+func buildTIFF(entries ...tiffEntry) []byte {
+	data := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(entries)))
+	valuesAt := len(data) + len(entries)*12 + 4
+
+	var values []byte
+	for _, e := range entries {
+		data = binary.LittleEndian.AppendUint16(data, e.tag)
+		data = binary.LittleEndian.AppendUint16(data, e.kind)
+		data = binary.LittleEndian.AppendUint32(data, e.count)
+		if len(e.value) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, e.value)
+			data = append(data, inline...)
+			continue
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(valuesAt+len(values)))
+		values = append(values, e.value...)
+	}
+	data = append(data, 0, 0, 0, 0)
+	return append(data, values...)
+}
+
+func asciiEntry(tag uint16, text string) tiffEntry {
+	value := append([]byte(text), 0)
+	return tiffEntry{tag: tag, kind: tiffTypeASCII, count: uint32(len(value)), value: value}
+}
+
+// jpegWithSegments wraps APP1 payloads in a minimal JPEG
+func jpegWithSegments(payloads ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, payload := range payloads {
+		data = append(data, 0xFF, 0xE1)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+		data = append(data, payload...)
+	}
+	return append(data, 0xFF, 0xDA, 0, 2, 0xFF, 0xD9)
+}
+
+func TestReadTIFFMetadata(t *testing.T) {
+	data := buildTIFF(
+		asciiEntry(tagImageDescription, "  Opening titles  "),
+		tiffEntry{tag: tagOrientation, kind: tiffTypeShort, count: 1, value: []byte{6, 0}},
+	)
+	md := readTIFFMetadata(data)
+	if md.Description != "Opening titles" || md.Orientation != 6 {
+		t.Errorf("got %+v", md)
+	}
+}
+
+func TestReadJPEGMetadata(t *testing.T) {
+	exif := append([]byte("Exif\x00\x00"), buildTIFF(asciiEntry(tagImageDescription, "Stage left"))...)
+	xmp := append(append([]byte{}, xmpHeader...),
+		`<x:xmpmeta><dc:title><rdf:Alt><rdf:li xml:lang="x-default">Fish &amp; Chips</rdf:li></rdf:Alt></dc:title></x:xmpmeta>`...)
+
+	md := readJPEGMetadata(jpegWithSegments(exif, xmp))
+	if md.Description != "Stage left" || md.XMPTitle != "Fish & Chips" {
+		t.Errorf("got %+v", md)
+	}
+	if md.title() != "Stage left" {
+		t.Errorf("title is %q, want the description first", md.title())
+	}
+}
+
+func TestXMPTitle(t *testing.T) {
+	tests := map[string]string{
+		"alternatives": `<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Intro</rdf:li><rdf:li xml:lang="de">Einleitung</rdf:li></rdf:Alt></dc:title>`,
+		"attributes":   `<dc:title rdf:parseType="Resource"><rdf:Alt><rdf:li>Intro</rdf:li></rdf:Alt></dc:title>`,
+		// The items of later elements are not the title
+		"empty title":    `<dc:title></dc:title><dc:subject><rdf:Bag><rdf:li>keyword</rdf:li></rdf:Bag></dc:subject>`,
+		"unclosed title": `<dc:title><rdf:Alt>`,
+		"no title":       `<dc:creator><rdf:Seq><rdf:li>Someone</rdf:li></rdf:Seq></dc:creator>`,
+		"similar tag":    `<dc:titles><rdf:li>Wrong</rdf:li></dc:titles>`,
+	}
+	want := map[string]string{"alternatives": "Intro", "attributes": "Intro"}
+
+	for name, packet := range tests {
+		if got := xmpTitle([]byte(packet)); got != want[name] {
+			t.Errorf("%s: got %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func TestReadTIFFMetadataMalformed(t *testing.T) {
+	valid := buildTIFF(asciiEntry(tagImageDescription, "A long enough description"))
+
+	tests := map[string][]byte{
+		"byte order":     append([]byte("XX"), valid[2:]...),
+		"ifd past end":   append(append([]byte{}, valid[:4]...), 0xF0, 0xFF, 0xFF, 0xFF),
+		"ifd at the end": append(append([]byte{}, valid[:4]...), byte(len(valid)-1), 0, 0, 0),
+	}
+	// A value offset near 4 GiB must not wrap around to a small one
+	wrapped := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint32(wrapped[18:], 0xFFFFFFF0)
+	tests["value offset wraps"] = wrapped
+	// A count that does not fit after the offset
+	long := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint32(long[14:], 0xFFFFFFFF)
+	tests["value count"] = long
+
+	for name, data := range tests {
+		if md := readTIFFMetadata(data); md.Description != "" {
+			t.Errorf("%s: read %q", name, md.Description)
+		}
+	}
+
+	// Every truncation of valid metadata is read without panicking
+	for n := range valid {
+		readTIFFMetadata(valid[:n])
+	}
+	jpeg := jpegWithSegments(append([]byte("Exif\x00\x00"), valid...))
+	for n := range jpeg {
+		readJPEGMetadata(jpeg[:n])
+	}
+}
+
+func TestReadImageMetadataFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.png")
+	packet := `<?xpacket?><dc:title><rdf:Alt><rdf:li>From PNG</rdf:li></rdf:Alt></dc:title>`
+	if err := os.WriteFile(path, append([]byte("\x89PNG\r\n\x1a\n"), packet...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md, err := readImageMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.title() != "From PNG" {
+		t.Errorf("title is %q", md.title())
+	}
+}
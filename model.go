@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"image/color"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/disintegration/imaging"
 
 	"github.com/buffos/cli-prepare-for-streamdeck/config"
 )
@@ -75,6 +77,8 @@ type model struct {
 	borderWidth   textinput.Model
 	pathInput     textinput.Model
 	oscPrefix     textinput.Model
+	oscTargets    textinput.Model
+	oscQueryAddr  textinput.Model
 	borderColor   textinput.Model
 	err           error
 	config        *config.Config
@@ -88,18 +92,29 @@ type model struct {
 	currentPath   string
 	availableDirs []DirectoryInfo
 	oscOption     config.OscPrefixOption
+	borderStyle   config.BorderStyle
+	exporters     exporterRegistry
+	formats       []bool
+	query         oscQueryBrowser
 	mediaType     config.MediaType
 	step          int
 	dirSelectIdx  int
 	oscPrefixIdx  int
 	mediaTypeIdx  int
+	borderIdx     int
+	formatIdx     int
+	metaTitles    bool
+	editTargets   bool
+	browsing      bool
 	done          bool
 }
 
 func initialModel() model {
 	cfg, err := config.LoadConfig()
+	var configErr error
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
+		// Report invalid configs right away instead of failing mid-run
+		configErr = fmt.Errorf("error loading config: %v", err)
 		cfg = &config.DefaultConfig
 	}
 
@@ -120,6 +135,12 @@ func initialModel() model {
 	oscPrefix := textinput.New()
 	oscPrefix.Placeholder = "Enter custom OSC prefix (e.g. /streamdeck/custom)"
 
+	oscTargets := textinput.New()
+	oscTargets.Placeholder = fmt.Sprintf("host:port, host:port (default: %s:%d)", config.DefaultOscHost, config.DefaultOscPort)
+
+	oscQueryAddr := textinput.New()
+	oscQueryAddr.Placeholder = "OSCQuery server host:port (e.g. 127.0.0.1:9000)"
+
 	borderColor := textinput.New()
 	borderColor.Placeholder = fmt.Sprintf("Enter border color (default: %s)", cfg.BorderColor)
 	borderColor.SetValue(cfg.BorderColor)
@@ -128,22 +149,34 @@ func initialModel() model {
 	borderWidth.Placeholder = fmt.Sprintf("Enter border width (default: %d)", cfg.BorderWidth)
 	borderWidth.SetValue(strconv.Itoa(cfg.BorderWidth))
 
+	// media_config.json is what the deck reads, so it starts selected
+	exporters := newExporterRegistry(cfg)
+	formats := make([]bool, len(exporters))
+	formats[0] = true
+
 	return model{
 		step:          0,
 		pathInput:     pathInput,
 		oscPrefix:     oscPrefix,
+		oscTargets:    oscTargets,
+		oscQueryAddr:  oscQueryAddr,
 		borderColor:   borderColor,
 		borderWidth:   borderWidth,
 		mediaTypeIdx:  0,
 		oscPrefixIdx:  0,
+		borderIdx:     0,
 		currentPath:   currentPath,
 		availableDirs: availableDirs,
 		dirSelectIdx:  0,
+		exporters:     exporters,
+		formats:       formats,
 		titleStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("#00FF00")).Bold(true),
 		promptStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")),
 		errorStyle:    lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")),
 		detailStyle:   lipgloss.NewStyle().Foreground(lipgloss.Color("#0000FF")),
 		config:        cfg,
+		err:           configErr,
+		metaTitles:    cfg.TitleFromMetadata,
 		// reset final data
 		searchPath: "",
 		mediaType:  config.MediaType(0),
@@ -164,8 +197,18 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // nolint:cyclop
 	var cmd tea.Cmd
 
-	switch msg := msg.(type) { // nolint:gocritic
+	switch msg := msg.(type) {
+	case oscQueryResultMsg:
+		if m.browsing && msg.addr == m.query.addr {
+			m.query.loaded(msg)
+		}
+		return m, nil
+
 	case tea.KeyMsg:
+		if m.browsing {
+			return m.handleQueryKey(msg)
+		}
+
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
 			if m.done {
@@ -184,6 +227,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // nolint:cyclop
 
 		case tea.KeyDown:
 			return m.handleDown()
+
+		case tea.KeySpace:
+			if !m.done && m.step == 5 {
+				m.formats[m.formatIdx] = !m.formats[m.formatIdx]
+				return m, nil
+			}
+
+		case tea.KeyRunes:
+			// Toggle metadata titles on the confirmation screen
+			if !m.done && m.step == 6 && m.mediaType == config.ImageType && msg.String() == "t" {
+				m.metaTitles = !m.metaTitles
+				return m, nil
+			}
 		}
 	}
 
@@ -191,9 +247,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // nolint:cyclop
 	if !m.done && m.step == 0 { //nolint:gocritic
 		m.pathInput, cmd = m.pathInput.Update(msg)
 		return m, cmd
-	} else if !m.done && m.step == 2 && m.oscPrefixIdx == len(m.config.OscPrefixOptions)-1 {
+	} else if !m.done && m.step == 2 && m.editTargets {
+		m.oscTargets, cmd = m.oscTargets.Update(msg)
+		return m, cmd
+	} else if !m.done && m.step == 2 && m.customSelected() {
 		m.oscPrefix, cmd = m.oscPrefix.Update(msg)
 		return m, cmd
+	} else if !m.done && m.step == 2 && m.querySelected() {
+		m.oscQueryAddr, cmd = m.oscQueryAddr.Update(msg)
+		return m, cmd
 	} else if !m.done && m.step == 3 {
 		m.borderColor, cmd = m.borderColor.Update(msg)
 		return m, cmd
@@ -280,30 +342,56 @@ func (m model) View() string { //nolint:cyclop
 	case 2: // OSC Prefix selection or input
 		s := m.titleStyle.Render("StreamDeck Media Preparation") + "\n\n"
 
-		if m.oscPrefixIdx == len(m.config.OscPrefixOptions)-1 {
-			// Show custom input field
-			s += m.promptStyle.Render("Enter Custom OSC Prefix:") + "\n"
-			s += m.oscPrefix.View()
-		} else {
-			// Show selection list
-			s += m.promptStyle.Render("Select OSC Prefix:") + "\n"
-			for i, opt := range m.config.OscPrefixOptions {
-				cursor := " "
-				if m.oscPrefixIdx == i {
-					cursor = ">"
-				}
-				s += fmt.Sprintf("%s %s (%s)\n", cursor, opt.Name, opt.Prefix)
+		if m.editTargets {
+			// Show target input for the chosen option
+			s += m.promptStyle.Render(fmt.Sprintf("OSC targets for %s (host:port, comma separated):", m.oscOption.DisplayAddress())) + "\n"
+			s += m.oscTargets.View()
+			return s
+		}
+		if m.browsing {
+			return s + m.query.view(m)
+		}
+
+		// Show selection list, with the input of the custom and OSCQuery rows
+		s += m.promptStyle.Render("Select OSC Prefix:") + "\n"
+		for i, opt := range m.config.OscPrefixOptions {
+			cursor := " "
+			if m.oscPrefixIdx == i {
+				cursor = ">"
 			}
+			s += fmt.Sprintf("%s %s (%s)\n", cursor, opt.Name, opt.DisplayAddress())
+		}
+		cursor := " "
+		if m.querySelected() {
+			cursor = ">"
+		}
+		s += fmt.Sprintf("%s Browse an OSCQuery server\n", cursor)
+
+		if m.customSelected() {
+			s += "\n" + m.promptStyle.Render("Enter Custom OSC Prefix:") + "\n"
+			s += m.oscPrefix.View()
+		} else if m.querySelected() {
+			s += "\n" + m.promptStyle.Render("Enter OSCQuery server address:") + "\n"
+			s += m.oscQueryAddr.View()
 		}
 		return s
 
-	case 3: // Border Color input
-		return fmt.Sprintf(
-			"%s\n\n%s\n\n%s",
-			m.titleStyle.Render("StreamDeck Media Preparation"),
-			m.promptStyle.Render(fmt.Sprintf("Enter border color (default: %s):", m.config.BorderColor)),
-			m.borderColor.View(),
-		)
+	case 3: // Border Color input and style selection
+		s := m.titleStyle.Render("StreamDeck Media Preparation") + "\n\n"
+		s += m.promptStyle.Render("Select border style (up/down):") + "\n"
+		for i, style := range m.borderStyles() {
+			cursor := " "
+			if m.borderIdx == i {
+				cursor = ">"
+			}
+			s += fmt.Sprintf("%s %s (%s)\n", cursor, style.Name, strings.Join(style.Colors, ", "))
+		}
+		if m.borderIdx == 0 {
+			s += "\n" + m.promptStyle.Render(fmt.Sprintf("Enter border color (default: %s):", m.config.BorderColor)) + "\n"
+			s += m.borderColor.View() + "\n"
+		}
+		s += "\n" + m.borderPreview()
+		return s
 
 	case 4: // Border Width input
 		return fmt.Sprintf(
@@ -313,16 +401,45 @@ func (m model) View() string { //nolint:cyclop
 			m.borderWidth.View(),
 		)
 
-	case 5: // Confirmation and processing
+	case 5: // Output formats
+		s := m.titleStyle.Render("StreamDeck Media Preparation") + "\n\n"
+		s += m.promptStyle.Render("Select output formats (space to toggle, Enter to continue):") + "\n"
+		for i, exporter := range m.exporters {
+			cursor := " "
+			if m.formatIdx == i {
+				cursor = ">"
+			}
+			check := " "
+			if m.formats[i] {
+				check = "x"
+			}
+			s += fmt.Sprintf("%s [%s] %s (%s)\n", cursor, check, exporter.Name(), exporter.Extension())
+		}
+		return s
+
+	case 6: // Confirmation and processing
+		titles := "file name"
+		if m.mediaType == config.ImageType {
+			titles += " (press t to use EXIF/XMP titles)"
+			if m.metaTitles {
+				titles = "EXIF/XMP title, else file name (press t to toggle)"
+			}
+		}
 		return fmt.Sprintf(
-			"%s\n\n%s\n\nPath: %s\nMedia Type: %s\nOSC Prefix: %s\nBorder Color: %s\nBorder Width: %s",
+			"%s\n\n%s\n\nPath: %s\nMedia Type: %s\nOSC Prefix: %s\nOSC Targets: %s\nBorder Style: %s (%s)\nBorder Width: %s\nOutput Format: %s\nExports: %s\nPages: %s\nTitles: %s",
 			m.titleStyle.Render("Confirm Details"),
 			m.promptStyle.Render("Press Enter to process or Esc to cancel"),
 			m.searchPath,
 			[]string{"Image", "Video", "Audio"}[m.mediaType],
-			m.oscOption.Prefix,
-			m.colorStr,
+			m.oscOption.DisplayAddress(),
+			config.FormatOscTargets(m.oscOption.OscTargets()),
+			m.borderStyle.Name,
+			strings.Join(m.borderStyle.Colors, ", "),
 			m.widthStr,
+			describeOutput(m.config.Output),
+			strings.Join(m.selectedExporters().names(), ", "),
+			m.describePages(),
+			titles,
 		)
 
 	default:
@@ -339,9 +456,14 @@ func (m *model) handleUp() (tea.Model, tea.Cmd) {
 	case 1:
 		m.mediaTypeIdx = (m.mediaTypeIdx - 1 + 3) % 3
 	case 2:
-		if m.oscPrefixIdx != len(m.config.OscPrefixOptions)-1 || !m.oscPrefix.Focused() {
-			m.oscPrefixIdx = (m.oscPrefixIdx - 1 + len(m.config.OscPrefixOptions)) % len(m.config.OscPrefixOptions)
+		if !m.editTargets {
+			m.oscPrefixIdx = (m.oscPrefixIdx - 1 + m.oscRows()) % m.oscRows()
+			m.focusOscInput()
 		}
+	case 3:
+		m.borderIdx = (m.borderIdx - 1 + len(m.borderStyles())) % len(m.borderStyles())
+	case 5:
+		m.formatIdx = (m.formatIdx - 1 + len(m.exporters)) % len(m.exporters)
 	}
 	return m, nil
 }
@@ -355,9 +477,14 @@ func (m *model) handleDown() (tea.Model, tea.Cmd) {
 	case 1:
 		m.mediaTypeIdx = (m.mediaTypeIdx + 1) % 3
 	case 2:
-		if m.oscPrefixIdx != len(m.config.OscPrefixOptions)-1 || !m.oscPrefix.Focused() {
-			m.oscPrefixIdx = (m.oscPrefixIdx + 1) % len(m.config.OscPrefixOptions)
+		if !m.editTargets {
+			m.oscPrefixIdx = (m.oscPrefixIdx + 1) % m.oscRows()
+			m.focusOscInput()
 		}
+	case 3:
+		m.borderIdx = (m.borderIdx + 1) % len(m.borderStyles())
+	case 5:
+		m.formatIdx = (m.formatIdx + 1) % len(m.exporters)
 	}
 	return m, nil
 }
@@ -415,33 +542,47 @@ func (m *model) handleEnter() (tea.Model, tea.Cmd) { // nolint:cyclop
 	case 1: // Media type selection
 		m.mediaType = config.MediaType(m.mediaTypeIdx)
 		m.step++
+		m.focusOscInput()
 		return m, nil
 
-	case 2: // OSC Prefix selection or input
-		if m.oscPrefixIdx == len(m.config.OscPrefixOptions)-1 {
-			// Custom prefix
-			prefix := m.oscPrefix.Value()
-			if prefix == "" {
-				m.err = errors.New("OSC prefix cannot be empty")
+	case 2: // OSC Prefix selection or input, then its targets
+		if m.editTargets {
+			targets, err := config.ParseOscTargets(m.oscTargets.Value())
+			if err != nil {
+				m.err = err
 				return m, nil
 			}
-			if !strings.HasPrefix(prefix, "/") {
-				prefix = "/" + prefix
+			m.oscOption.Targets = targets
+			m.editTargets = false
+			m.oscTargets.Blur()
+			m.step++
+			m.borderColor.Focus()
+			return m, nil
+		}
+
+		if m.querySelected() {
+			addr := strings.TrimSpace(m.oscQueryAddr.Value())
+			if addr == "" {
+				m.err = errors.New("OSCQuery server address cannot be empty")
+				return m, nil
 			}
-			m.oscOption.Prefix = prefix
-			m.oscOption.AugmentIndex = true
-			m.oscOption.ArgumentType = config.OscConstantType
-			m.oscOption.ArgumentBase = 1
+			m.browsing = true
+			m.query = oscQueryBrowser{addr: addr, loading: true}
+			return m, fetchOscQuery(addr)
+		}
+
+		if m.customSelected() {
+			option, err := customOscOption(m.oscPrefix.Value())
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.oscOption = option
 		} else {
-			// Selected prefix
-			m.oscOption.Name = m.config.OscPrefixOptions[m.oscPrefixIdx].Name
-			m.oscOption.Prefix = m.config.OscPrefixOptions[m.oscPrefixIdx].Prefix
-			m.oscOption.AugmentIndex = m.config.OscPrefixOptions[m.oscPrefixIdx].AugmentIndex
-			m.oscOption.ArgumentType = m.config.OscPrefixOptions[m.oscPrefixIdx].ArgumentType
-			m.oscOption.ArgumentBase = m.config.OscPrefixOptions[m.oscPrefixIdx].ArgumentBase
+			// Selected prefix, copied whole so templated arguments come along
+			m.oscOption = m.config.OscPrefixOptions[m.oscPrefixIdx]
 		}
-		m.step++
-		m.borderColor.Focus()
+		m.editOscTargets()
 		return m, nil
 
 	case 3: // Border Color
@@ -454,6 +595,14 @@ func (m *model) handleEnter() (tea.Model, tea.Cmd) { // nolint:cyclop
 			return m, nil
 		}
 		m.colorStr = color
+		m.borderStyle = m.borderStyles()[m.borderIdx]
+		if m.borderIdx == 0 {
+			m.borderStyle = solidBorderStyle(color)
+		}
+		if _, err := newBorderPainter(m.borderStyle, m.config.BorderWidth, false); err != nil {
+			m.err = err
+			return m, nil
+		}
 		m.step++
 		m.borderWidth.Focus()
 		return m, nil
@@ -472,10 +621,34 @@ func (m *model) handleEnter() (tea.Model, tea.Cmd) { // nolint:cyclop
 		m.step++
 		return m, nil
 
-	case 5: // Process files
+	case 5: // Output formats
+		if len(m.selectedExporters()) == 0 {
+			m.err = errors.New("select at least one output format")
+			return m, nil
+		}
+		m.step++
+		return m, nil
+
+	case 6: // Process files
 		width, _ := strconv.Atoi(m.widthStr)
-		err := processMediaFiles(m.searchPath, m.mediaType, m.oscOption, m.colorStr, width)
-		if err != nil {
+		opts := prepareOptions{
+			MediaType:         m.mediaType,
+			OscOption:         m.oscOption,
+			BorderStyle:       m.borderStyle,
+			BorderWidth:       width,
+			Output:            m.config.Output,
+			Exporters:         m.selectedExporters(),
+			TitleFromMetadata: m.metaTitles && m.mediaType == config.ImageType,
+		}
+		if m.config.PageLayout.Enabled {
+			pages, err := newPageOptions(m.config.Devices(), m.config.PageLayout)
+			if err != nil {
+				m.err = fmt.Errorf("invalid page layout: %v", err)
+				return m, nil
+			}
+			opts.Pages = pages
+		}
+		if err := processMediaFiles(m.searchPath, opts); err != nil {
 			m.err = err
 			return m, nil
 		}
@@ -486,6 +659,120 @@ func (m *model) handleEnter() (tea.Model, tea.Cmd) { // nolint:cyclop
 	return m, nil
 }
 
+// describePages tells whether the entries are split into pages, which is
+// set by page_layout in config.json
+func (m model) describePages() string {
+	if !m.config.PageLayout.Enabled {
+		return "one list (enable page_layout in config.json to split into pages)"
+	}
+	device, err := findDeviceProfile(m.config.Devices(), m.config.PageLayout.Device)
+	if err != nil {
+		return err.Error()
+	}
+	return "split for a " + device.Name + " with navigation keys"
+}
+
+// selectedExporters returns the output formats ticked in the format step
+func (m model) selectedExporters() exporterRegistry {
+	var selected exporterRegistry
+	for i, exporter := range m.exporters {
+		if m.formats[i] {
+			selected = append(selected, exporter)
+		}
+	}
+	return selected
+}
+
+// oscRows is the number of rows in the OSC prefix list: the configured
+// options followed by the OSCQuery browser
+func (m model) oscRows() int {
+	return len(m.config.OscPrefixOptions) + 1
+}
+
+// customSelected reports whether the custom prefix option, always the last
+// configured one, is selected
+func (m model) customSelected() bool {
+	return m.oscPrefixIdx == len(m.config.OscPrefixOptions)-1
+}
+
+func (m model) querySelected() bool {
+	return m.oscPrefixIdx == len(m.config.OscPrefixOptions)
+}
+
+// focusOscInput focuses the text input of the selected row, if it has one
+func (m *model) focusOscInput() {
+	m.oscPrefix.Blur()
+	m.oscQueryAddr.Blur()
+	if m.customSelected() {
+		m.oscPrefix.Focus()
+	} else if m.querySelected() {
+		m.oscQueryAddr.Focus()
+	}
+}
+
+// editOscTargets moves on to the targets of the chosen OSC option
+func (m *model) editOscTargets() {
+	m.oscPrefix.Blur()
+	m.oscQueryAddr.Blur()
+	m.editTargets = true
+	m.oscTargets.SetValue(config.FormatOscTargets(m.oscOption.OscTargets()))
+	m.oscTargets.Focus()
+}
+
+// handleQueryKey drives the OSCQuery browser. Esc returns to the prefix
+// list and Enter uses the selected node as the OSC option.
+func (m *model) handleQueryKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.browsing = false
+	case tea.KeyUp:
+		m.query.move(-1)
+	case tea.KeyDown:
+		m.query.move(1)
+	case tea.KeyEnter:
+		if m.query.loading || len(m.query.rows) == 0 {
+			return m, nil
+		}
+		option, err := m.query.selectedOption()
+		if err != nil {
+			m.query.err = err
+			return m, nil
+		}
+		m.query.err = nil
+		m.oscOption = option
+		m.browsing = false
+		m.editOscTargets()
+	}
+	return m, nil
+}
+
+// borderStyles lists the selectable border styles, starting with a solid
+// border in the colour currently typed into the input
+func (m model) borderStyles() []config.BorderStyle {
+	styles := []config.BorderStyle{solidBorderStyle(m.borderColor.Value())}
+	return append(styles, m.config.BorderStyles...)
+}
+
+// borderPreview renders a sample pressed key with the selected border style
+func (m model) borderPreview() string {
+	const previewColumns = 40
+
+	width, err := strconv.Atoi(m.borderWidth.Value())
+	if err != nil || width < 0 {
+		width = m.config.BorderWidth
+	}
+
+	painter, err := newBorderPainter(m.borderStyles()[m.borderIdx], width, false)
+	if err != nil {
+		return m.errorStyle.Render(fmt.Sprintf("Preview unavailable: %v", err))
+	}
+
+	sample := imaging.New(ThumbWidth, ThumbWidth*2/3, color.NRGBA{R: 64, G: 64, B: 64, A: 255})
+	return renderHalfBlocks(addBorder(sample, width, painter), previewColumns)
+}
+
 // formatFileSize converts file size in bytes to human-readable format
 func formatFileSize(size int64) string {
 	const (
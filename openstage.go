@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// openStageVersion is the Open Stage Control release whose session format
+// is written; newer releases upgrade it when the session is opened
+const openStageVersion = "1.26.2"
+
+var openStageExporter = tabletExporter{
+	write:     writeOpenStageSession,
+	name:      "openstage",
+	command:   "export-openstage",
+	extension: ".json",
+	app:       "Open Stage Control",
+}
+
+// openStageSession is an Open Stage Control session file
+type openStageSession struct {
+	Content     openStageWidget `json:"content"`
+	CreatedWith string          `json:"createdWith"`
+	Version     string          `json:"version"`
+	Type        string          `json:"type"`
+}
+
+// openStageWidget holds the properties of a widget that the export sets;
+// Open Stage Control fills in the rest with its defaults
+type openStageWidget struct {
+	Left    any               `json:"left,omitempty"`
+	Top     any               `json:"top,omitempty"`
+	Width   any               `json:"width,omitempty"`
+	Height  any               `json:"height,omitempty"`
+	On      any               `json:"on,omitempty"`
+	Off     any               `json:"off,omitempty"`
+	Type    string            `json:"type"`
+	ID      string            `json:"id"`
+	Label   string            `json:"label,omitempty"`
+	Mode    string            `json:"mode,omitempty"`
+	CSS     string            `json:"css,omitempty"`
+	OnValue string            `json:"onValue,omitempty"`
+	Tabs    []openStageWidget `json:"tabs,omitempty"`
+	Widgets []openStageWidget `json:"widgets,omitempty"`
+	Bypass  bool              `json:"bypass,omitempty"`
+}
+
+// writeOpenStageSession writes a session with one tab per page of buttons.
+// The buttons do not send messages of their own; a script sends the
+// entry's commands to their targets when the button is pressed.
+func writeOpenStageSession(w io.Writer, data tabletData) error {
+	root := openStageWidget{Type: "root", ID: "root", Width: "auto", Height: "auto"}
+	for p, page := range data.Pages {
+		tab := openStageWidget{Type: "tab", ID: fmt.Sprintf("page_%d", p+1), Label: fmt.Sprintf("Page %d", p+1)}
+		for _, button := range page {
+			entry := button.Entry
+			tabletWarnings(entry, "Open Stage Control")
+
+			widget := openStageWidget{
+				Type:    "button",
+				ID:      fmt.Sprintf("key_%d", button.Index+1),
+				Label:   entry.Title,
+				Mode:    "tap",
+				On:      1,
+				Off:     0,
+				Left:    button.X,
+				Top:     button.Y,
+				Width:   button.Width,
+				Height:  button.Height,
+				Bypass:  true,
+				OnValue: openStageScript(entry),
+			}
+			if entry.Image != "" {
+				widget.CSS = fmt.Sprintf(":host {\n  background-image: url(%q);\n  background-size: contain;\n  background-repeat: no-repeat;\n  background-position: center;\n}", data.ImageURL(entry.Image))
+			}
+			tab.Widgets = append(tab.Widgets, widget)
+		}
+		root.Tabs = append(root.Tabs, tab)
+	}
+
+	session := openStageSession{
+		Content:     root,
+		CreatedWith: "open-stage-control",
+		Version:     openStageVersion,
+		Type:        "session",
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(session)
+}
+
+// openStageScript sends the commands of an entry when its button goes on,
+// each after the delays before it have passed
+func openStageScript(entry MediaEntry) string {
+	var sb strings.Builder
+	sb.WriteString("if (value !== getProp(this, 'on')) return\n")
+
+	delay := 0
+	for i, cmd := range entry.OscCommands {
+		delay += entryDelay(entry, i)
+		target := oscTarget(cmd)
+		if target.Transport != osc.UDP {
+			fmt.Printf("Warning: %s sends %s over %s, Open Stage Control scripts send UDP\n", entry.Title, cmd.OscPath, target.Transport)
+		}
+
+		msg, err := oscMessage(cmd)
+		if err != nil {
+			fmt.Printf("Warning: %s: %v\n", entry.Title, err)
+			continue
+		}
+		args := []string{jsString(target.Address()), jsString(cmd.OscPath)}
+		for _, arg := range msg.Arguments {
+			args = append(args, openStageArgument(arg))
+		}
+
+		send := "send(" + strings.Join(args, ", ") + ")"
+		if delay > 0 {
+			send = fmt.Sprintf("setTimeout(() => %s, %d)", send, delay)
+		}
+		sb.WriteString(send + "\n")
+	}
+	return sb.String()
+}
+
+// openStageArgument writes an argument as a typed value, so ints and floats
+// keep their types
+func openStageArgument(arg any) string {
+	switch v := arg.(type) {
+	case int32:
+		return fmt.Sprintf("{type: 'i', value: %d}", v)
+	case float32:
+		return fmt.Sprintf("{type: 'f', value: %v}", v)
+	case string:
+		return fmt.Sprintf("{type: 's', value: %s}", jsString(v))
+	case bool:
+		if v {
+			return "{type: 'T', value: true}"
+		}
+		return "{type: 'F', value: false}"
+	}
+	return "{type: 'N', value: null}"
+}
+
+// jsString quotes a string for a script
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,277 @@
+package osc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transport selects how packets reach the receiver
+type Transport string
+
+const (
+	UDP               Transport = "udp"
+	TCPSLIP           Transport = "tcp-slip"
+	TCPLengthPrefixed Transport = "tcp-length-prefixed"
+)
+
+const (
+	dialTimeout  = 2 * time.Second
+	writeTimeout = 2 * time.Second
+	maxAttempts  = 2
+	firstBackoff = 500 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+	maxFrameSize = 1 << 20
+)
+
+// SLIP special bytes, as used by OSC 1.1 over stream transports
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+// ParseTransport checks a transport name, with an empty name meaning UDP
+func ParseTransport(name string) (Transport, error) {
+	switch t := Transport(name); t {
+	case "":
+		return UDP, nil
+	case UDP, TCPSLIP, TCPLengthPrefixed:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown osc transport %q", name)
+}
+
+// Client sends OSC packets to one receiver and may be shared between
+// goroutines. TCP connections are opened on first use and re-established
+// when the receiver drops them. After a failed dial, sends fail at once until
+// a back-off that doubles with every failure has passed, so a receiver that
+// is down costs one dial timeout instead of one per packet.
+type Client struct {
+	retryAt   time.Time
+	conn      net.Conn
+	dialErr   error
+	hangup    chan struct{}
+	addr      string
+	transport Transport
+	backoff   time.Duration
+	mu        sync.Mutex
+}
+
+// Dial creates a client for a host:port address
+func Dial(transport Transport, addr string) (*Client, error) {
+	if _, err := ParseTransport(string(transport)); err != nil {
+		return nil, err
+	}
+	if transport == "" {
+		transport = UDP
+	}
+
+	c := &Client{addr: addr, transport: transport}
+	if transport != UDP {
+		return c, nil
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	network := "tcp"
+	if c.transport == UDP {
+		network = "udp"
+	}
+	conn, err := net.DialTimeout(network, c.addr, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to reach osc receiver %s: %v", c.addr, err)
+	}
+	c.conn = conn
+	if c.transport == UDP {
+		return nil
+	}
+
+	// Receivers may reply on the stream; discard that and notice when they
+	// hang up, as writes to a closed connection can still succeed once
+	hangup := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(hangup)
+	}()
+	c.hangup = hangup
+	return nil
+}
+
+// drop closes a TCP connection so the next send opens a fresh one
+func (c *Client) drop() {
+	c.conn.Close()
+	c.conn = nil
+	c.hangup = nil
+}
+
+// Send encodes and sends a message or bundle
+func (c *Client) Send(packet Packet) error {
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	frame := data
+	switch c.transport {
+	case TCPSLIP:
+		frame = EncodeSLIP(data)
+	case TCPLengthPrefixed:
+		frame = EncodeLengthPrefixed(data)
+	}
+
+	if c.transport == UDP {
+		if _, err := c.conn.Write(frame); err != nil {
+			return fmt.Errorf("failed to send osc packet to %s: %v", c.addr, err)
+		}
+		return nil
+	}
+	return c.writeStream(frame)
+}
+
+// writeStream writes a frame to a TCP receiver, reconnecting when the
+// connection has dropped
+func (c *Client) writeStream(frame []byte) error {
+	var lastErr error
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if c.conn != nil {
+			select {
+			case <-c.hangup:
+				c.drop()
+			default:
+			}
+		}
+
+		if c.conn == nil {
+			if wait := time.Until(c.retryAt); wait > 0 {
+				return fmt.Errorf("%v (next attempt in %v)", c.dialErr, wait.Round(time.Millisecond))
+			}
+			if err := c.connect(); err != nil {
+				c.backoff = min(max(c.backoff*2, firstBackoff), maxBackoff)
+				c.retryAt = time.Now().Add(c.backoff)
+				c.dialErr = err
+				return err
+			}
+			c.backoff = 0
+		}
+
+		_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, err := c.conn.Write(frame)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		// The receiver went away, try once more over a fresh connection
+		c.drop()
+	}
+
+	return fmt.Errorf("failed to send osc packet to %s after %d attempts: %v", c.addr, maxAttempts, lastErr)
+}
+
+// Close releases the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// EncodeSLIP frames a packet with double-ended SLIP
+func EncodeSLIP(data []byte) []byte {
+	frame := make([]byte, 0, len(data)+2)
+	frame = append(frame, slipEnd)
+	for _, b := range data {
+		switch b {
+		case slipEnd:
+			frame = append(frame, slipEsc, slipEscEnd)
+		case slipEsc:
+			frame = append(frame, slipEsc, slipEscEsc)
+		default:
+			frame = append(frame, b)
+		}
+	}
+	return append(frame, slipEnd)
+}
+
+// ReadSLIP reads the next non-empty SLIP frame from a stream
+func ReadSLIP(r *bufio.Reader) ([]byte, error) {
+	var frame bytes.Buffer
+	escaped := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case escaped:
+			switch b {
+			case slipEscEnd:
+				frame.WriteByte(slipEnd)
+			case slipEscEsc:
+				frame.WriteByte(slipEsc)
+			default:
+				return nil, fmt.Errorf("invalid slip escape 0x%02X", b)
+			}
+			escaped = false
+		case b == slipEsc:
+			escaped = true
+		case b == slipEnd:
+			// Double-ended framing produces empty frames between packets
+			if frame.Len() > 0 {
+				return frame.Bytes(), nil
+			}
+		default:
+			frame.WriteByte(b)
+		}
+
+		if frame.Len() > maxFrameSize {
+			return nil, errors.New("slip frame is too large")
+		}
+	}
+}
+
+// EncodeLengthPrefixed frames a packet with its size as a big-endian int32,
+// as OSC 1.0 specifies for stream transports
+func EncodeLengthPrefixed(data []byte) []byte {
+	frame := make([]byte, 4, len(data)+4)
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	return append(frame, data...)
+}
+
+// ReadLengthPrefixed reads the next length-prefixed frame from a stream
+func ReadLengthPrefixed(r io.Reader) ([]byte, error) {
+	var size int32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame size %d", size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
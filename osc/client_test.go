@@ -0,0 +1,192 @@
+package osc
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiver accepts TCP connections and passes on the packets read from
+// them. With hangUp set it closes every connection after its first packet.
+type receiver struct {
+	listener net.Listener
+	packets  chan Packet
+	accepted chan struct{}
+}
+
+func startReceiver(t *testing.T, transport Transport, hangUp bool) *receiver {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	r := &receiver{listener: listener, packets: make(chan Packet, 16), accepted: make(chan struct{}, 16)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r.accepted <- struct{}{}
+			go r.serve(t, conn, transport, hangUp)
+		}
+	}()
+	return r
+}
+
+func (r *receiver) serve(t *testing.T, conn net.Conn, transport Transport, hangUp bool) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var frame []byte
+		var err error
+		if transport == TCPSLIP {
+			frame, err = ReadSLIP(reader)
+		} else {
+			frame, err = ReadLengthPrefixed(reader)
+		}
+		if err != nil {
+			return
+		}
+		packet, err := Decode(frame)
+		if err != nil {
+			t.Errorf("receiver: %v", err)
+			return
+		}
+		r.packets <- packet
+		if hangUp {
+			return
+		}
+	}
+}
+
+func (r *receiver) next(t *testing.T) Packet {
+	t.Helper()
+	select {
+	case packet := <-r.packets:
+		return packet
+	case <-time.After(5 * time.Second):
+		t.Fatal("no packet arrived")
+		return nil
+	}
+}
+
+func TestStreamFraming(t *testing.T) {
+	// The blob holds the SLIP END and ESC bytes, which must be escaped
+	packets := []Packet{
+		NewMessage("/clip/1", int32(1), "intro", []byte{slipEnd, slipEsc, 0, slipEnd}),
+		&Bundle{Timetag: Immediate, Elements: []Packet{NewMessage("/clip/2"), NewMessage("/go", 0.5)}},
+	}
+
+	for _, transport := range []Transport{TCPSLIP, TCPLengthPrefixed} {
+		t.Run(string(transport), func(t *testing.T) {
+			r := startReceiver(t, transport, false)
+			c, err := Dial(transport, r.listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			for _, packet := range packets {
+				if err := c.Send(packet); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, want := range packets {
+				if got := r.next(t); !reflect.DeepEqual(got, want) {
+					t.Errorf("received %#v, want %#v", got, want)
+				}
+			}
+			if len(r.accepted) != 1 {
+				t.Errorf("client opened %d connections, want 1", len(r.accepted))
+			}
+		})
+	}
+}
+
+func TestStreamReconnect(t *testing.T) {
+	for _, transport := range []Transport{TCPSLIP, TCPLengthPrefixed} {
+		t.Run(string(transport), func(t *testing.T) {
+			r := startReceiver(t, transport, true)
+			c, err := Dial(transport, r.listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			first := NewMessage("/first", int32(1))
+			if err := c.Send(first); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.next(t); !reflect.DeepEqual(got, first) {
+				t.Fatalf("received %#v, want %#v", got, first)
+			}
+
+			// Wait until the client has seen the receiver hang up
+			c.mu.Lock()
+			hangup := c.hangup
+			c.mu.Unlock()
+			select {
+			case <-hangup:
+			case <-time.After(5 * time.Second):
+				t.Fatal("client did not notice the dropped connection")
+			}
+
+			second := NewMessage("/second", int32(2))
+			if err := c.Send(second); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.next(t); !reflect.DeepEqual(got, second) {
+				t.Errorf("received %#v, want %#v", got, second)
+			}
+			if len(r.accepted) != 2 {
+				t.Errorf("client opened %d connections, want 2", len(r.accepted))
+			}
+		})
+	}
+}
+
+func TestUnreachableReceiverFailsFast(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	c, err := Dial(TCPSLIP, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Send(NewMessage("/go")); err == nil {
+		t.Fatal("send to a closed port succeeded")
+	}
+	if c.backoff != firstBackoff {
+		t.Errorf("back-off is %v after one failed dial, want %v", c.backoff, firstBackoff)
+	}
+
+	// Within the back-off the client must not dial again
+	err = c.Send(NewMessage("/go"))
+	if err == nil || !strings.Contains(err.Error(), "next attempt") {
+		t.Errorf("second send returned %v, want a back-off error", err)
+	}
+	if c.backoff != firstBackoff {
+		t.Errorf("back-off grew to %v without a dial", c.backoff)
+	}
+
+	// Once it has passed, the next failure doubles it
+	c.retryAt = time.Time{}
+	if err := c.Send(NewMessage("/go")); err == nil {
+		t.Fatal("send to a closed port succeeded")
+	}
+	if c.backoff != 2*firstBackoff {
+		t.Errorf("back-off is %v after two failed dials, want %v", c.backoff, 2*firstBackoff)
+	}
+}
@@ -0,0 +1,305 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Packet is either a Message or a Bundle
+type Packet interface {
+	MarshalBinary() ([]byte, error)
+}
+
+// Message is a single OSC message. Arguments may be int32, int64, float32,
+// float64, Timetag, string, []byte, bool or nil.
+type Message struct {
+	Address   string
+	Arguments []any
+}
+
+// Bundle groups packets that are dispatched together at the time given by
+// its timetag. Bundles may be nested.
+type Bundle struct {
+	Elements []Packet
+	Timetag  Timetag
+}
+
+// Timetag is an NTP timestamp: seconds since 1900 in the upper 32 bits and
+// the fraction of a second in the lower 32 bits
+type Timetag uint64
+
+// Immediate is the special timetag asking the receiver to act on arrival
+const Immediate Timetag = 1
+
+// ntpEpochOffset is the number of seconds between 1900 and 1970
+const ntpEpochOffset = 2208988800
+
+const bundleTag = "#bundle"
+
+// NewTimetag converts a time to a timetag
+func NewTimetag(t time.Time) Timetag {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return Timetag(secs<<32 | frac)
+}
+
+// Time converts a timetag back to a time. Immediate maps to the zero time.
+func (t Timetag) Time() time.Time {
+	if t == Immediate {
+		return time.Time{}
+	}
+	secs := int64(t>>32) - ntpEpochOffset
+	nanos := int64((uint64(t) & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nanos)
+}
+
+// NewMessage creates a message for an address
+func NewMessage(address string, args ...any) *Message {
+	return &Message{Address: address, Arguments: args}
+}
+
+// TypeTags returns the OSC type tag string of the arguments, without the
+// leading comma
+func (m *Message) TypeTags() (string, error) {
+	var sb strings.Builder
+	for i, arg := range m.Arguments {
+		switch v := arg.(type) {
+		case int32:
+			sb.WriteByte('i')
+		case int64:
+			sb.WriteByte('h')
+		case float32:
+			sb.WriteByte('f')
+		case float64:
+			sb.WriteByte('d')
+		case Timetag:
+			sb.WriteByte('t')
+		case string:
+			sb.WriteByte('s')
+		case []byte:
+			sb.WriteByte('b')
+		case bool:
+			if v {
+				sb.WriteByte('T')
+			} else {
+				sb.WriteByte('F')
+			}
+		case nil:
+			sb.WriteByte('N')
+		default:
+			return "", fmt.Errorf("argument %d has unsupported type %T", i+1, arg)
+		}
+	}
+	return sb.String(), nil
+}
+
+// MarshalBinary encodes the message in OSC wire format
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if !strings.HasPrefix(m.Address, "/") {
+		return nil, fmt.Errorf("osc address %q must start with /", m.Address)
+	}
+	tags, err := m.TypeTags()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeString(&buf, m.Address)
+	writeString(&buf, ","+tags)
+
+	for _, arg := range m.Arguments {
+		switch v := arg.(type) {
+		case int32:
+			_ = binary.Write(&buf, binary.BigEndian, v)
+		case int64:
+			_ = binary.Write(&buf, binary.BigEndian, v)
+		case float32:
+			_ = binary.Write(&buf, binary.BigEndian, math.Float32bits(v))
+		case float64:
+			_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+		case Timetag:
+			_ = binary.Write(&buf, binary.BigEndian, uint64(v))
+		case string:
+			writeString(&buf, v)
+		case []byte:
+			_ = binary.Write(&buf, binary.BigEndian, int32(len(v)))
+			buf.Write(v)
+			writePadding(&buf, len(v))
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalBinary encodes the bundle and all nested elements
+func (b *Bundle) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	writeString(&buf, bundleTag)
+	_ = binary.Write(&buf, binary.BigEndian, uint64(b.Timetag))
+
+	for i, elem := range b.Elements {
+		data, err := elem.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("bundle element %d: %v", i+1, err)
+		}
+		_ = binary.Write(&buf, binary.BigEndian, int32(len(data)))
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeString writes a null terminated string padded to four bytes
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+	writePadding(buf, len(s)+1)
+}
+
+func writePadding(buf *bytes.Buffer, n int) {
+	for n%4 != 0 {
+		buf.WriteByte(0)
+		n++
+	}
+}
+
+// Decode parses an OSC packet, including nested bundles. Packets must be a
+// multiple of four bytes long, as every part of them is padded to four.
+func Decode(data []byte) (Packet, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("osc packet of %d bytes is not a multiple of four", len(data))
+	}
+	if bytes.HasPrefix(data, []byte(bundleTag+"\x00")) {
+		return decodeBundle(data)
+	}
+	return decodeMessage(data)
+}
+
+func decodeBundle(data []byte) (*Bundle, error) {
+	if len(data) < 16 {
+		return nil, errors.New("osc bundle is too short")
+	}
+	bundle := &Bundle{Timetag: Timetag(binary.BigEndian.Uint64(data[8:16]))}
+
+	pos := 16
+	for pos < len(data) {
+		if pos+4 > len(data) {
+			return nil, errors.New("osc bundle element size is truncated")
+		}
+		size := int(int32(binary.BigEndian.Uint32(data[pos:])))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return nil, fmt.Errorf("osc bundle element of %d bytes does not fit", size)
+		}
+
+		elem, err := Decode(data[pos : pos+size])
+		if err != nil {
+			return nil, err
+		}
+		bundle.Elements = append(bundle.Elements, elem)
+		pos += size
+	}
+
+	return bundle, nil
+}
+
+func decodeMessage(data []byte) (*Message, error) {
+	address, pos, err := readString(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("osc address: %v", err)
+	}
+	if !strings.HasPrefix(address, "/") {
+		return nil, fmt.Errorf("osc address %q must start with /", address)
+	}
+	msg := &Message{Address: address}
+	if pos >= len(data) {
+		// Old implementations may omit the type tag string
+		return msg, nil
+	}
+
+	tags, pos, err := readString(data, pos)
+	if err != nil {
+		return nil, fmt.Errorf("osc type tags: %v", err)
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return nil, fmt.Errorf("osc type tags %q must start with a comma", tags)
+	}
+
+	for _, tag := range tags[1:] {
+		var arg any
+		switch tag {
+		case 'i', 'f':
+			if pos+4 > len(data) {
+				return nil, fmt.Errorf("osc argument %q is truncated", tag)
+			}
+			bits := binary.BigEndian.Uint32(data[pos:])
+			if tag == 'i' {
+				arg = int32(bits)
+			} else {
+				arg = math.Float32frombits(bits)
+			}
+			pos += 4
+		case 'h', 'd', 't':
+			if pos+8 > len(data) {
+				return nil, fmt.Errorf("osc argument %q is truncated", tag)
+			}
+			bits := binary.BigEndian.Uint64(data[pos:])
+			switch tag {
+			case 'h':
+				arg = int64(bits)
+			case 'd':
+				arg = math.Float64frombits(bits)
+			default:
+				arg = Timetag(bits)
+			}
+			pos += 8
+		case 's', 'S':
+			arg, pos, err = readString(data, pos)
+			if err != nil {
+				return nil, err
+			}
+		case 'b':
+			if pos+4 > len(data) {
+				return nil, errors.New("osc blob size is truncated")
+			}
+			size := int(int32(binary.BigEndian.Uint32(data[pos:])))
+			pos += 4
+			if size < 0 || pos+size > len(data) {
+				return nil, fmt.Errorf("osc blob of %d bytes does not fit", size)
+			}
+			arg = append([]byte(nil), data[pos:pos+size]...)
+			pos += size + (4-size%4)%4
+		case 'T':
+			arg = true
+		case 'F':
+			arg = false
+		case 'N':
+			arg = nil
+		default:
+			return nil, fmt.Errorf("unsupported osc type tag %q", tag)
+		}
+		msg.Arguments = append(msg.Arguments, arg)
+	}
+
+	return msg, nil
+}
+
+// readString reads a padded OSC string and returns the position after it
+func readString(data []byte, pos int) (string, int, error) {
+	if pos >= len(data) {
+		return "", 0, errors.New("string is missing")
+	}
+	end := bytes.IndexByte(data[pos:], 0)
+	if end < 0 {
+		return "", 0, errors.New("string is not terminated")
+	}
+	s := string(data[pos : pos+end])
+	pos += end + 1
+	pos += (4 - pos%4) % 4
+	return s, pos, nil
+}
@@ -0,0 +1,148 @@
+package osc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	msg := NewMessage("/layer/1/clip/02/connect",
+		int32(-7), int64(1)<<40, float32(0.5), 2.25, NewTimetag(time.Unix(1700000000, 0)),
+		"clip", []byte{1, 2, 3}, true, false, nil)
+
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%4 != 0 {
+		t.Fatalf("encoded message is %d bytes, not a multiple of four", len(data))
+	}
+
+	packet, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(packet, msg) {
+		t.Errorf("decoded %#v, want %#v", packet, msg)
+	}
+}
+
+func TestNestedBundleRoundTrip(t *testing.T) {
+	outer := NewTimetag(time.Unix(1700000000, 250_000_000))
+	inner := NewTimetag(time.Unix(1700000001, 0))
+	bundle := &Bundle{
+		Timetag: outer,
+		Elements: []Packet{
+			NewMessage("/first", int32(1)),
+			&Bundle{
+				Timetag: inner,
+				Elements: []Packet{
+					NewMessage("/nested/a", "text"),
+					&Bundle{Timetag: Immediate, Elements: []Packet{NewMessage("/nested/deeper", float32(1.5))}},
+				},
+			},
+			NewMessage("/last"),
+		},
+	}
+
+	data, err := bundle.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, ok := packet.(*Bundle)
+	if !ok {
+		t.Fatalf("decoded a %T, want a bundle", packet)
+	}
+	// An argument-less message decodes with nil arguments
+	bundle.Elements[2] = &Message{Address: "/last"}
+	if !reflect.DeepEqual(decoded, bundle) {
+		t.Errorf("decoded %#v, want %#v", decoded, bundle)
+	}
+
+	nested := decoded.Elements[1].(*Bundle)
+	if nested.Timetag != inner {
+		t.Errorf("nested timetag is %v, want %v", nested.Timetag, inner)
+	}
+	// The fraction of a timetag is finer than a nanosecond, so allow rounding
+	if got := decoded.Timetag.Time(); got.Sub(time.Unix(1700000000, 250_000_000)).Abs() > time.Microsecond {
+		t.Errorf("outer timetag is %v", got)
+	}
+	if !nested.Elements[1].(*Bundle).Timetag.Time().IsZero() {
+		t.Error("immediate timetag does not map to the zero time")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	msg, err := NewMessage("/addr", int32(1), "text", []byte{9, 9, 9, 9, 9}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := (&Bundle{Timetag: Immediate, Elements: []Packet{
+		&Bundle{Timetag: Immediate, Elements: []Packet{NewMessage("/x", int32(2))}},
+	}}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":                  {},
+		"misaligned message":     append(append([]byte{}, msg...), 0),
+		"misaligned bundle":      append(append([]byte{}, bundle...), 0, 0),
+		"no address slash":       []byte("addr\x00\x00\x00\x00,i\x00\x00\x00\x00\x00\x01"),
+		"unterminated address":   []byte("/abc"),
+		"missing comma":          []byte("/a\x00\x00i\x00\x00\x00"),
+		"unknown tag":            []byte("/a\x00\x00,q\x00\x00"),
+		"truncated int":          []byte("/a\x00\x00,ii\x00\x00\x00\x00\x01"),
+		"truncated double":       []byte("/a\x00\x00,d\x00\x00\x00\x00\x00\x01"),
+		"unterminated string":    []byte("/a\x00\x00,s\x00\x00abcd"),
+		"negative blob size":     []byte("/a\x00\x00,b\x00\x00\xff\xff\xff\xfc"),
+		"oversized blob":         []byte("/a\x00\x00,b\x00\x00\x00\x00\x00\x40abcd"),
+		"short bundle":           []byte("#bundle\x00\x00\x00\x00\x00"),
+		"element size truncated": append([]byte("#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01"), 0, 0),
+		"negative element size":  append([]byte("#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01"), 0xff, 0xff, 0xff, 0xf0),
+		"oversized element":      append([]byte("#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01"), 0, 0, 0, 0x40, '/', 'a', 0, 0),
+		"misaligned element":     append([]byte("#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x03"), '/', 'a', 0, 0),
+	}
+
+	// A bad address deep inside a nested bundle fails the whole packet
+	nested := append([]byte{}, bundle...)
+	nested[bytes.Index(nested, []byte("/x"))] = 'x'
+	tests["bad nested element"] = nested
+
+	// Cutting a message after its address leaves a valid message without
+	// type tags, so only cuts from the type tags on are errors
+	for i := 12; i < len(msg); i += 4 {
+		tests[fmt.Sprintf("message cut at %d bytes", i)] = msg[:i]
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if packet, err := Decode(data); err == nil {
+				t.Errorf("decoded %#v, want an error", packet)
+			}
+		})
+	}
+}
+
+func TestDecodeTruncatedNeverPanics(t *testing.T) {
+	data, err := (&Bundle{Timetag: Immediate, Elements: []Packet{
+		NewMessage("/a", int32(1), "two", []byte{3}, 4.0),
+		&Bundle{Timetag: Immediate, Elements: []Packet{NewMessage("/b", int64(5))}},
+	}}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every prefix either decodes or fails cleanly
+	for i := 0; i < len(data); i++ {
+		_, _ = Decode(data[:i])
+	}
+}
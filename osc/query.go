@@ -0,0 +1,142 @@
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const queryTimeout = 3 * time.Second
+
+// OSCQuery access flags of a node
+const (
+	AccessNone      = 0
+	AccessRead      = 1
+	AccessWrite     = 2
+	AccessReadWrite = 3
+)
+
+// QueryNode is one node of an OSCQuery namespace. Containers have Contents,
+// methods have a Type with one OSC type tag per argument. Access is nil when
+// the server leaves it out.
+type QueryNode struct {
+	Contents    map[string]*QueryNode `json:"CONTENTS"`
+	FullPath    string                `json:"FULL_PATH"`
+	Description string                `json:"DESCRIPTION"`
+	Type        string                `json:"TYPE"`
+	Value       []any                 `json:"VALUE"`
+	Access      *int                  `json:"ACCESS"`
+}
+
+// QueryHostInfo describes where the OSCQuery server accepts OSC messages
+type QueryHostInfo struct {
+	Name      string `json:"NAME"`
+	OscIP     string `json:"OSC_IP"`
+	Transport string `json:"OSC_TRANSPORT"`
+	OscPort   int    `json:"OSC_PORT"`
+}
+
+// IsMethod reports whether the node is an address messages can be sent to
+func (n *QueryNode) IsMethod() bool {
+	return n.Type != "" || len(n.Contents) == 0
+}
+
+// Writable reports whether the server accepts values for the node. Servers
+// that leave out ACCESS are assumed to accept them for methods with a type,
+// while an explicit ACCESS of 0 means no access at all.
+func (n *QueryNode) Writable() bool {
+	if n.Access == nil {
+		return n.Type != ""
+	}
+	return *n.Access&AccessWrite != 0
+}
+
+// Walk visits the node and its descendants depth first, with children in
+// name order. depth is 0 for the node itself.
+func (n *QueryNode) Walk(visit func(node *QueryNode, depth int)) {
+	n.walk(visit, 0)
+}
+
+func (n *QueryNode) walk(visit func(node *QueryNode, depth int), depth int) {
+	visit(n, depth)
+
+	names := make([]string, 0, len(n.Contents))
+	for name := range n.Contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if child := n.Contents[name]; child != nil {
+			child.walk(visit, depth+1)
+		}
+	}
+}
+
+// FetchNamespace reads the address tree of the OSCQuery server at host:port
+func FetchNamespace(ctx context.Context, addr string) (*QueryNode, error) {
+	var root QueryNode
+	if err := queryJSON(ctx, addr, "/", &root); err != nil {
+		return nil, err
+	}
+	if root.FullPath == "" {
+		root.FullPath = "/"
+	}
+	fillPaths(&root)
+	return &root, nil
+}
+
+// FetchHostInfo reads the HOST_INFO of the OSCQuery server at host:port. The
+// OSC address falls back to the query host when the server does not give one.
+func FetchHostInfo(ctx context.Context, addr string) (QueryHostInfo, error) {
+	var info QueryHostInfo
+	if err := queryJSON(ctx, addr, "/?HOST_INFO", &info); err != nil {
+		return info, err
+	}
+	if info.OscIP == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			info.OscIP = host
+		}
+	}
+	return info, nil
+}
+
+// fillPaths sets the full path of children that only carry their name
+func fillPaths(node *QueryNode) {
+	for name, child := range node.Contents {
+		if child == nil {
+			continue
+		}
+		if child.FullPath == "" {
+			child.FullPath = strings.TrimSuffix(node.FullPath, "/") + "/" + name
+		}
+		fillPaths(child)
+	}
+}
+
+func queryJSON(ctx context.Context, addr, path string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("invalid oscquery address %q: %v", addr, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("oscquery request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oscquery server at %s answered %s", addr, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid oscquery reply from %s: %v", addr, err)
+	}
+	return nil
+}
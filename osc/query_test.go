@@ -0,0 +1,141 @@
+package osc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testNamespace is the reply of a small OSCQuery server. The children of
+// /layer carry only their names, and the nodes cover a missing ACCESS, an
+// explicit 0 and a read-only value.
+const testNamespace = `{
+	"FULL_PATH": "/",
+	"CONTENTS": {
+		"layer": {
+			"DESCRIPTION": "Layers",
+			"CONTENTS": {
+				"opacity": {"TYPE": "f", "ACCESS": 3},
+				"clip": {"TYPE": "is"},
+				"name": {"TYPE": "s", "ACCESS": 1}
+			}
+		},
+		"info": {"FULL_PATH": "/info", "TYPE": "s", "ACCESS": 0},
+		"go": {"FULL_PATH": "/go"}
+	}
+}`
+
+// newQueryServer serves testNamespace, with HOST_INFO replying hostInfo or
+// 404 when it is empty
+func newQueryServer(t *testing.T, hostInfo string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.RawQuery == "HOST_INFO" {
+			if hostInfo == "" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(hostInfo))
+			return
+		}
+		_, _ = w.Write([]byte(testNamespace))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchNamespaceWalk(t *testing.T) {
+	server := newQueryServer(t, "")
+	root, err := FetchNamespace(context.Background(), server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	root.Walk(func(node *QueryNode, depth int) {
+		visited = append(visited, strings.Repeat(" ", depth)+node.FullPath)
+	})
+	want := []string{"/", " /go", " /info", " /layer", "  /layer/clip", "  /layer/name", "  /layer/opacity"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("walk visited %q, want %q", visited, want)
+	}
+
+	layer := root.Contents["layer"]
+	if layer.IsMethod() {
+		t.Error("/layer has contents but is reported as a method")
+	}
+	if !root.Contents["go"].IsMethod() {
+		t.Error("/go has no contents but is not reported as a method")
+	}
+
+	writable := map[string]bool{
+		"/layer/opacity": true,  // ACCESS 3
+		"/layer/clip":    true,  // no ACCESS, but a type
+		"/layer/name":    false, // ACCESS 1, read only
+		"/info":          false, // ACCESS 0
+		"/go":            false, // no ACCESS and no type
+	}
+	root.Walk(func(node *QueryNode, _ int) {
+		want, ok := writable[node.FullPath]
+		if ok && node.Writable() != want {
+			t.Errorf("%s: Writable() = %v, want %v", node.FullPath, node.Writable(), want)
+		}
+	})
+}
+
+func TestFetchHostInfo(t *testing.T) {
+	tests := map[string]struct {
+		reply string
+		want  QueryHostInfo
+	}{
+		"full": {
+			reply: `{"NAME": "Mixer", "OSC_IP": "10.0.0.5", "OSC_PORT": 9000, "OSC_TRANSPORT": "TCP"}`,
+			want:  QueryHostInfo{Name: "Mixer", OscIP: "10.0.0.5", OscPort: 9000, Transport: "TCP"},
+		},
+		"no osc ip": {
+			reply: `{"NAME": "Mixer", "OSC_PORT": 9000}`,
+			want:  QueryHostInfo{Name: "Mixer", OscIP: "127.0.0.1", OscPort: 9000},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newQueryServer(t, tt.reply)
+			info, err := FetchHostInfo(context.Background(), server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info != tt.want {
+				t.Errorf("got %+v, want %+v", info, tt.want)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		server := newQueryServer(t, "")
+		if _, err := FetchHostInfo(context.Background(), server.Listener.Addr().String()); err == nil {
+			t.Error("expected an error from a server without HOST_INFO")
+		}
+	})
+}
+
+func TestQueryNodeAccessRoundTrip(t *testing.T) {
+	var node QueryNode
+	if err := json.Unmarshal([]byte(`{"TYPE": "i", "ACCESS": 0}`), &node); err != nil {
+		t.Fatal(err)
+	}
+	if node.Access == nil || *node.Access != AccessNone {
+		t.Fatalf("ACCESS 0 decoded as %v", node.Access)
+	}
+	if node.Writable() {
+		t.Error("a node with ACCESS 0 is reported as writable")
+	}
+}
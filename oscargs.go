@@ -0,0 +1,394 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// oscBuilder turns an OSC prefix option into the commands for each file,
+// with its templates parsed once per run
+type oscBuilder struct {
+	option   config.OscPrefixOption
+	commands []oscCommandBuilder
+}
+
+// oscCommandBuilder renders one command of an option. Without an address
+// template the option prefix is used, and legacyValue sends the single int
+// derived from the option's argument type when there are no arguments.
+type oscCommandBuilder struct {
+	address     *template.Template
+	args        []oscArgument
+	targets     []config.OscTarget
+	delay       int
+	legacyValue bool
+}
+
+// oscArgument is an argument spec with its template parsed
+type oscArgument struct {
+	tmpl    *template.Template
+	argType config.OscArgType
+}
+
+// customOscOption is the option for a prefix typed by the user, sending the
+// constant 1 to the prefix with the file index appended. A prefix with
+// template actions is used as an address template instead.
+func customOscOption(prefix string) (config.OscPrefixOption, error) {
+	if prefix == "" {
+		return config.OscPrefixOption{}, errors.New("OSC prefix cannot be empty")
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	option := config.OscPrefixOption{
+		Prefix:       prefix,
+		AugmentIndex: true,
+		ArgumentType: config.OscConstantType,
+		ArgumentBase: 1,
+	}
+	if strings.Contains(prefix, "{{") {
+		option.AddressTemplate = prefix
+		if err := option.Validate(); err != nil {
+			return option, fmt.Errorf("invalid OSC address template: %v", err)
+		}
+	}
+	return option, nil
+}
+
+func newOscBuilder(option config.OscPrefixOption) (*oscBuilder, error) {
+	if err := option.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := &oscBuilder{option: option}
+	if len(option.Commands) == 0 {
+		cmd, err := newOscCommandBuilder(option.AddressTemplate, option.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		cmd.targets = option.OscTargets()
+		cmd.legacyValue = true
+		b.commands = append(b.commands, cmd)
+		return b, nil
+	}
+
+	for _, tmpl := range option.Commands {
+		cmd, err := newOscCommandBuilder(tmpl.Address, tmpl.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		cmd.targets = tmpl.Targets
+		if len(cmd.targets) == 0 {
+			cmd.targets = option.OscTargets()
+		}
+		cmd.delay = tmpl.Delay
+		b.commands = append(b.commands, cmd)
+	}
+	return b, nil
+}
+
+func newOscCommandBuilder(address string, specs []config.OscArgumentSpec) (oscCommandBuilder, error) {
+	var cmd oscCommandBuilder
+	if address != "" {
+		tmpl, err := config.ParseTemplate("address", address)
+		if err != nil {
+			return cmd, err
+		}
+		cmd.address = tmpl
+	}
+
+	for i, spec := range specs {
+		tmpl, err := config.ParseTemplate(fmt.Sprintf("argument %d", i+1), spec.Template)
+		if err != nil {
+			return cmd, err
+		}
+		cmd.args = append(cmd.args, oscArgument{tmpl: tmpl, argType: spec.Type})
+	}
+	return cmd, nil
+}
+
+// templateData describes one file for the OSC templates
+func (b *oscBuilder) templateData(filePath, title string, index int, mediaType config.MediaType) config.TemplateData {
+	padding := b.option.IndexPadding
+	if padding == 0 {
+		padding = 2
+	}
+
+	return config.TemplateData{
+		Title:       title,
+		Slug:        config.Slugify(title),
+		FullPath:    filePath,
+		Ext:         strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), "."),
+		MediaType:   mediaType.String(),
+		Folder:      filepath.Base(filepath.Dir(filePath)),
+		Prefix:      b.option.Prefix,
+		PaddedIndex: fmt.Sprintf("%0*d", padding, index+1),
+		Index:       index + 1,
+		Base:        b.option.ArgumentBase,
+	}
+}
+
+// build renders the OSC commands for one file, each once for every target.
+// The returned delays line up with the commands: a command template's delay
+// is put before the first copy of the command and the other copies follow
+// immediately.
+func (b *oscBuilder) build(data config.TemplateData) ([]OscCommand, []int, error) {
+	var commands []OscCommand
+	var delays []int
+
+	for i, cmd := range b.commands {
+		command, err := b.buildCommand(cmd, data)
+		if err != nil {
+			if len(b.commands) > 1 {
+				err = fmt.Errorf("command %d: %v", i+1, err)
+			}
+			return nil, nil, err
+		}
+
+		for t, target := range cmd.targets {
+			command.OscHost = target.Host
+			command.OscPort = target.Port
+			command.OscTransport = target.Transport
+			if command.OscTransport == "" {
+				command.OscTransport = osc.UDP
+			}
+			commands = append(commands, command)
+			if t == 0 {
+				delays = append(delays, cmd.delay)
+			} else {
+				delays = append(delays, 0)
+			}
+		}
+	}
+	return commands, delays, nil
+}
+
+// buildCommand renders the address and arguments of one command for one file
+func (b *oscBuilder) buildCommand(cmd oscCommandBuilder, data config.TemplateData) (OscCommand, error) {
+	oscPath := b.option.Prefix
+	if cmd.address != nil {
+		var sb strings.Builder
+		if err := cmd.address.Execute(&sb, data); err != nil {
+			return OscCommand{}, err
+		}
+		oscPath = sb.String()
+		if err := config.CheckOscAddress(oscPath); err != nil {
+			return OscCommand{}, err
+		}
+	} else if b.option.AugmentIndex {
+		oscPath += data.PaddedIndex
+	}
+
+	command := OscCommand{OscPath: oscPath}
+
+	if len(cmd.args) == 0 && cmd.legacyValue {
+		// A single int, counting up from the base for serial options
+		var oscValue int
+		switch b.option.ArgumentType {
+		case config.OscSerialType:
+			oscValue = b.option.ArgumentBase + data.Index - 1
+		case config.OscConstantType:
+			oscValue = b.option.ArgumentBase
+		}
+		command.OscValue = []any{oscValue}
+		command.OscTypeTags = "i"
+		return command, nil
+	}
+
+	values, tags, err := buildOscArguments(cmd.args, data)
+	if err != nil {
+		return OscCommand{}, err
+	}
+	command.OscValue = values
+	command.OscTypeTags = tags
+	return command, nil
+}
+
+// buildOscArguments renders the arguments for one file and returns the typed
+// values together with their OSC type tags
+func buildOscArguments(args []oscArgument, data config.TemplateData) ([]any, string, error) {
+	values := make([]any, 0, len(args))
+	var tags strings.Builder
+
+	for i, arg := range args {
+		var sb strings.Builder
+		if err := arg.tmpl.Execute(&sb, data); err != nil {
+			return nil, "", err
+		}
+		text := strings.TrimSpace(sb.String())
+
+		switch arg.argType {
+		case config.OscIntArg:
+			v, err := evalExpression(text, true)
+			if err != nil {
+				return nil, "", fmt.Errorf("argument %d: %v", i+1, err)
+			}
+			n, err := toInt32(v)
+			if err != nil {
+				return nil, "", fmt.Errorf("argument %d: %v", i+1, err)
+			}
+			values = append(values, n)
+			tags.WriteByte('i')
+
+		case config.OscFloatArg:
+			v, err := evalExpression(text, false)
+			if err != nil {
+				return nil, "", fmt.Errorf("argument %d: %v", i+1, err)
+			}
+			values = append(values, float32(v))
+			tags.WriteByte('f')
+
+		case config.OscStringArg:
+			values = append(values, sb.String())
+			tags.WriteByte('s')
+
+		case config.OscBoolArg:
+			v, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, "", fmt.Errorf("argument %d: %q is not a boolean", i+1, text)
+			}
+			values = append(values, v)
+			if v {
+				tags.WriteByte('T')
+			} else {
+				tags.WriteByte('F')
+			}
+		}
+	}
+
+	return values, tags.String(), nil
+}
+
+// evalExpression evaluates an arithmetic expression with + - * / %, unary
+// minus and parentheses. In integer mode division truncates.
+func evalExpression(expr string, integer bool) (float64, error) {
+	p := &exprParser{input: expr, integer: integer}
+	v, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", p.input[p.pos:], expr)
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	input   string
+	pos     int
+	integer bool
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	v, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '+' && p.input[p.pos] != '-') {
+			return v, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		rhs, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			v += rhs
+		} else {
+			v -= rhs
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	v, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || !strings.ContainsRune("*/%", rune(p.input[p.pos])) {
+			return v, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			v *= rhs
+		case '/':
+			if rhs == 0 {
+				return 0, errors.New("division by zero")
+			}
+			v /= rhs
+			if p.integer {
+				v = math.Trunc(v)
+			}
+		case '%':
+			if rhs == 0 {
+				return 0, errors.New("division by zero")
+			}
+			v = math.Mod(v, rhs)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == '-' {
+		p.pos++
+		v, err := p.parseUnary()
+		return -v, err
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		p.pos++
+		v, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return 0, fmt.Errorf("missing ) in expression %q", p.input)
+		}
+		p.pos++
+		return v, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("expected a number in expression %q", p.input)
+	}
+	v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	if p.integer && v != math.Trunc(v) {
+		return 0, fmt.Errorf("%q is not an integer", p.input[start:p.pos])
+	}
+	return v, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// oscQueryVisibleRows is how many nodes the browser shows at once
+const oscQueryVisibleRows = 15
+
+// oscQueryBrowser holds the address tree fetched from an OSCQuery server
+type oscQueryBrowser struct {
+	err     error
+	root    *osc.QueryNode
+	info    osc.QueryHostInfo
+	addr    string
+	rows    []oscQueryRow
+	cursor  int
+	loading bool
+}
+
+// oscQueryRow is one line of the flattened address tree
+type oscQueryRow struct {
+	node  *osc.QueryNode
+	depth int
+}
+
+// oscQueryResultMsg delivers the reply of an OSCQuery server
+type oscQueryResultMsg struct {
+	err  error
+	root *osc.QueryNode
+	info osc.QueryHostInfo
+	addr string
+}
+
+// fetchOscQuery reads the namespace and host info of a server in the
+// background. Servers without HOST_INFO are still browsable.
+func fetchOscQuery(addr string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := context.Background()
+		root, err := osc.FetchNamespace(ctx, addr)
+		if err != nil {
+			return oscQueryResultMsg{addr: addr, err: err}
+		}
+		info, err := osc.FetchHostInfo(ctx, addr)
+		if err != nil {
+			info = osc.QueryHostInfo{}
+		}
+		return oscQueryResultMsg{addr: addr, root: root, info: info}
+	}
+}
+
+// loaded stores a server reply, flattening the tree into rows
+func (b *oscQueryBrowser) loaded(msg oscQueryResultMsg) {
+	b.loading = false
+	b.err = msg.err
+	b.root = msg.root
+	b.info = msg.info
+	b.rows = nil
+	b.cursor = 0
+	if msg.root == nil {
+		return
+	}
+
+	msg.root.Walk(func(node *osc.QueryNode, depth int) {
+		if node == msg.root {
+			return
+		}
+		b.rows = append(b.rows, oscQueryRow{node: node, depth: depth - 1})
+	})
+}
+
+func (b *oscQueryBrowser) move(delta int) {
+	if len(b.rows) > 0 {
+		b.cursor = (b.cursor + delta + len(b.rows)) % len(b.rows)
+	}
+}
+
+// view lists the visible part of the tree with the selected node's details
+func (b oscQueryBrowser) view(m model) string {
+	s := m.promptStyle.Render(fmt.Sprintf("OSCQuery namespace of %s (Enter to use, Esc to go back):", b.addr)) + "\n"
+
+	switch {
+	case b.loading:
+		return s + "Loading...\n"
+	case b.root == nil:
+		return s + m.errorStyle.Render(b.err.Error()) + "\n"
+	case len(b.rows) == 0:
+		return s + m.errorStyle.Render("The server has no OSC addresses.") + "\n"
+	}
+
+	start := 0
+	if b.cursor >= oscQueryVisibleRows {
+		start = b.cursor - oscQueryVisibleRows + 1
+	}
+	end := min(start+oscQueryVisibleRows, len(b.rows))
+
+	for i := start; i < end; i++ {
+		row := b.rows[i]
+		cursor := " "
+		if b.cursor == i {
+			cursor = ">"
+		}
+		name := row.node.FullPath[strings.LastIndex(row.node.FullPath, "/")+1:]
+		if !row.node.IsMethod() {
+			name += "/"
+		} else if row.node.Type != "" {
+			name += fmt.Sprintf(" [%s]", row.node.Type)
+		}
+		s += fmt.Sprintf("%s %s%s\n", cursor, strings.Repeat("  ", row.depth), name)
+	}
+
+	selected := b.rows[b.cursor].node
+	s += "\n" + m.detailStyle.Render("Address: "+selected.FullPath)
+	if selected.Description != "" {
+		s += "\n" + m.detailStyle.Render(selected.Description)
+	}
+	if selected.IsMethod() && !selected.Writable() {
+		s += "\n" + m.errorStyle.Render("The server marks this address as read only")
+	}
+	if b.err != nil {
+		s += "\n" + m.errorStyle.Render(b.err.Error())
+	}
+	return s
+}
+
+// selectedOption turns the selected node into an OSC prefix option. A
+// container becomes a prefix with the file index appended, a method is used
+// as is with its arguments hinted from the OSC type tags.
+func (b oscQueryBrowser) selectedOption() (config.OscPrefixOption, error) {
+	node := b.rows[b.cursor].node
+
+	option := config.OscPrefixOption{
+		Name:         node.Description,
+		Prefix:       node.FullPath,
+		ArgumentType: config.OscConstantType,
+		ArgumentBase: 1,
+		AugmentIndex: !node.IsMethod(),
+	}
+	if option.Name == "" {
+		option.Name = "OSCQuery " + node.FullPath
+	}
+
+	if node.IsMethod() {
+		args, err := oscArgumentHints(node.Type)
+		if err != nil {
+			return option, fmt.Errorf("%s: %v", node.FullPath, err)
+		}
+		option.Arguments = args
+	}
+
+	if b.info.OscPort != 0 {
+		option.Host = b.info.OscIP
+		option.Port = b.info.OscPort
+		if strings.EqualFold(b.info.Transport, "TCP") {
+			// OSC 1.1 frames TCP streams with SLIP
+			option.Transport = osc.TCPSLIP
+		}
+	}
+
+	if err := option.Validate(); err != nil {
+		return option, err
+	}
+	return option, nil
+}
+
+// oscArgumentHints suggests arguments for an OSCQuery type string. Ints count
+// the files, strings carry the title and floats and booleans are switched on.
+// Tags without a value such as N and I are skipped.
+func oscArgumentHints(typeTags string) ([]config.OscArgumentSpec, error) {
+	var args []config.OscArgumentSpec
+	for _, tag := range typeTags {
+		switch tag {
+		case 'i', 'h':
+			args = append(args, config.OscArgumentSpec{Type: config.OscIntArg, Template: "{{.Index}}"})
+		case 'f', 'd':
+			args = append(args, config.OscArgumentSpec{Type: config.OscFloatArg, Template: "1"})
+		case 's', 'S':
+			args = append(args, config.OscArgumentSpec{Type: config.OscStringArg, Template: "{{.Title}}"})
+		case 'T', 'F':
+			args = append(args, config.OscArgumentSpec{Type: config.OscBoolArg, Template: "true"})
+		case 'N', 'I':
+		default:
+			return nil, fmt.Errorf("unsupported osc type tag %q", tag)
+		}
+	}
+	return args, nil
+}
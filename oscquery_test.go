@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// clipNamespace is a namespace with one container and one writable method.
+// Fetching it over HTTP is covered by the osc package.
+func clipNamespace() *osc.QueryNode {
+	access := osc.AccessWrite
+	return &osc.QueryNode{FullPath: "/", Contents: map[string]*osc.QueryNode{
+		"clip": {FullPath: "/clip", Contents: map[string]*osc.QueryNode{
+			"play": {FullPath: "/clip/play", Description: "Play clip", Type: "isfTN", Access: &access},
+		}},
+	}}
+}
+
+// browse loads a server reply into the browser the way the wizard does
+func browse(info osc.QueryHostInfo) oscQueryBrowser {
+	b := oscQueryBrowser{addr: "127.0.0.1:5678", loading: true}
+	b.loaded(oscQueryResultMsg{addr: b.addr, root: clipNamespace(), info: info})
+	return b
+}
+
+func TestOscQuerySelectedOption(t *testing.T) {
+	b := browse(osc.QueryHostInfo{OscIP: "10.0.0.5", OscPort: 7000, Transport: "TCP"})
+
+	var paths []string
+	for _, row := range b.rows {
+		paths = append(paths, row.node.FullPath)
+	}
+	if want := []string{"/clip", "/clip/play"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("rows are %q, want %q", paths, want)
+	}
+
+	b.cursor = 1
+	option, err := b.selectedOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if option.Name != "Play clip" || option.Prefix != "/clip/play" || option.AugmentIndex {
+		t.Errorf("method became %q at %q with AugmentIndex %v", option.Name, option.Prefix, option.AugmentIndex)
+	}
+	if option.Host != "10.0.0.5" || option.Port != 7000 || option.Transport != osc.TCPSLIP {
+		t.Errorf("target is %s %s:%d, want tcp-slip 10.0.0.5:7000", option.Transport, option.Host, option.Port)
+	}
+	wantArgs := []config.OscArgumentSpec{
+		{Type: config.OscIntArg, Template: "{{.Index}}"},
+		{Type: config.OscStringArg, Template: "{{.Title}}"},
+		{Type: config.OscFloatArg, Template: "1"},
+		{Type: config.OscBoolArg, Template: "true"},
+	}
+	if !reflect.DeepEqual(option.Arguments, wantArgs) {
+		t.Errorf("arguments are %+v, want %+v", option.Arguments, wantArgs)
+	}
+
+	b.cursor = 0
+	option, err = b.selectedOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if option.Prefix != "/clip" || !option.AugmentIndex || len(option.Arguments) != 0 {
+		t.Errorf("container became %q with AugmentIndex %v and %d arguments", option.Prefix, option.AugmentIndex, len(option.Arguments))
+	}
+}
+
+func TestOscQueryWithoutHostInfo(t *testing.T) {
+	b := browse(osc.QueryHostInfo{})
+	b.cursor = 1
+	option, err := b.selectedOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without HOST_INFO the option keeps the default target
+	if option.Host != "" || option.Port != 0 || option.Transport != "" {
+		t.Errorf("target is %s %s:%d, want the default", option.Transport, option.Host, option.Port)
+	}
+}
+
+func TestOscArgumentHintsRejectsUnknownTags(t *testing.T) {
+	if _, err := oscArgumentHints("ib"); err == nil {
+		t.Error("blob argument was accepted")
+	}
+}
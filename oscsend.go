@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
+)
+
+// oscTarget returns the receiver of a command, filling in the defaults for
+// entries generated before hosts were configurable
+func oscTarget(cmd OscCommand) config.OscTarget {
+	target := config.OscTarget{Host: cmd.OscHost, Port: cmd.OscPort, Transport: cmd.OscTransport}
+	if target.Host == "" {
+		target.Host = config.DefaultOscHost
+	}
+	if target.Port == 0 {
+		target.Port = config.DefaultOscPort
+	}
+	return target
+}
+
+// oscMessage converts a generated command into an OSC message, using the
+// recorded type tags to restore the argument types JSON does not keep
+func oscMessage(cmd OscCommand) (*osc.Message, error) {
+	if cmd.OscTypeTags != "" && len(cmd.OscTypeTags) != len(cmd.OscValue) {
+		return nil, fmt.Errorf("%s has %d type tags for %d values", cmd.OscPath, len(cmd.OscTypeTags), len(cmd.OscValue))
+	}
+
+	msg := osc.NewMessage(cmd.OscPath)
+	for i, value := range cmd.OscValue {
+		var tag byte
+		if cmd.OscTypeTags != "" {
+			tag = cmd.OscTypeTags[i]
+		}
+		arg, err := oscArgumentValue(tag, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s argument %d: %v", cmd.OscPath, i+1, err)
+		}
+		msg.Arguments = append(msg.Arguments, arg)
+	}
+	return msg, nil
+}
+
+// oscArgumentValue converts a value to the Go type of its OSC type tag. Without
+// a tag the type is guessed, with whole numbers sent as ints.
+func oscArgumentValue(tag byte, value any) (any, error) {
+	number, isNumber := toFloat64(value)
+
+	switch tag {
+	case 'i':
+		if !isNumber {
+			return nil, fmt.Errorf("%v is not a number", value)
+		}
+		return toInt32(number)
+	case 'f':
+		if !isNumber {
+			return nil, fmt.Errorf("%v is not a number", value)
+		}
+		return float32(number), nil
+	case 's':
+		return fmt.Sprint(value), nil
+	case 'T', 'F':
+		return tag == 'T', nil
+	case 0:
+		switch v := value.(type) {
+		case string, bool, nil:
+			return v, nil
+		}
+		if !isNumber {
+			return nil, fmt.Errorf("unsupported value %v", value)
+		}
+		if number == math.Trunc(number) && number >= math.MinInt32 && number <= math.MaxInt32 {
+			return int32(number), nil
+		}
+		return float32(number), nil
+	}
+	return nil, fmt.Errorf("unsupported type tag %q", tag)
+}
+
+// toInt32 converts a whole number to an OSC int, refusing values outside its
+// range instead of letting them wrap around
+func toInt32(number float64) (int32, error) {
+	if number < math.MinInt32 || number > math.MaxInt32 {
+		return 0, fmt.Errorf("%.0f does not fit in a 32-bit int", number)
+	}
+	return int32(number), nil
+}
+
+func toFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// oscClients keeps one client per target, so connections and the back-off
+// of unreachable targets carry over from one run of an entry to the next
+type oscClients struct {
+	clients map[config.OscTarget]*osc.Client
+	mu      sync.Mutex
+}
+
+func newOscClients() *oscClients {
+	return &oscClients{clients: map[config.OscTarget]*osc.Client{}}
+}
+
+func (c *oscClients) get(target config.OscTarget) (*osc.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[target]; ok {
+		return client, nil
+	}
+	client, err := osc.Dial(target.Transport, target.Address())
+	if err != nil {
+		return nil, err
+	}
+	c.clients[target] = client
+	return client, nil
+}
+
+func (c *oscClients) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for target, client := range c.clients {
+		client.Close()
+		delete(c.clients, target)
+	}
+}
+
+// sendOscCommand sends one generated command to its target
+func sendOscCommand(clients *oscClients, cmd OscCommand) error {
+	msg, err := oscMessage(cmd)
+	if err != nil {
+		return err
+	}
+	client, err := clients.get(oscTarget(cmd))
+	if err != nil {
+		return err
+	}
+	return client.Send(msg)
+}
+
+// sendEntryBundles sends one bundle per target. Commands whose delays put
+// them later than the bundle time are wrapped in nested bundles carrying
+// their own timetag.
+func sendEntryBundles(entry MediaEntry, clients *oscClients) error {
+	start := time.Now().Add(time.Duration(entry.BundleDelay) * time.Millisecond)
+
+	var order []config.OscTarget
+	bundles := map[config.OscTarget]*osc.Bundle{}
+
+	offset := 0
+	for i, cmd := range entry.OscCommands {
+		offset += entryDelay(entry, i)
+
+		msg, err := oscMessage(cmd)
+		if err != nil {
+			return err
+		}
+
+		target := oscTarget(cmd)
+		bundle, ok := bundles[target]
+		if !ok {
+			bundle = &osc.Bundle{Timetag: osc.NewTimetag(start)}
+			if entry.BundleDelay == 0 {
+				bundle.Timetag = osc.Immediate
+			}
+			bundles[target] = bundle
+			order = append(order, target)
+		}
+
+		if offset == 0 {
+			bundle.Elements = append(bundle.Elements, msg)
+			continue
+		}
+		bundle.Elements = append(bundle.Elements, &osc.Bundle{
+			Timetag:  osc.NewTimetag(start.Add(time.Duration(offset) * time.Millisecond)),
+			Elements: []osc.Packet{msg},
+		})
+	}
+
+	var errs []error
+	for _, target := range order {
+		c, err := clients.get(target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := c.Send(bundles[target]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// entryDelay returns the delay before the i-th command, tolerating entries
+// whose delays list is shorter than their commands
+func entryDelay(entry MediaEntry, i int) int {
+	if i < len(entry.Delays) {
+		return entry.Delays[i]
+	}
+	return 0
+}
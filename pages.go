@@ -0,0 +1,356 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+	"github.com/disintegration/imaging"
+)
+
+// The actions of navigation keys
+const (
+	navPrevious = "previous"
+	navHome     = "home"
+	navNext     = "next"
+)
+
+// NavigationKey is a key that switches to another page instead of running
+// actions. Page and Position place it like an entry, and Target is the page
+// it switches to. Previous and next wrap around, home goes to the first page.
+type NavigationKey struct {
+	Action       string `json:"action"`
+	Image        string `json:"image"`
+	ImagePressed string `json:"image_pressed"`
+	Page         int    `json:"page"`
+	Position     int    `json:"position"`
+	Target       int    `json:"target_page"`
+}
+
+// describe says what pressing the key does
+func (n NavigationKey) describe() string {
+	switch n.Action {
+	case navPrevious:
+		return fmt.Sprintf("Previous page (%d)", n.Target)
+	case navNext:
+		return fmt.Sprintf("Next page (%d)", n.Target)
+	}
+	return fmt.Sprintf("Home (page %d)", n.Target)
+}
+
+// pageOptions lays the entries out on the pages of Device, keeping Keys free
+// for navigation
+type pageOptions struct {
+	Device config.DeviceProfile
+	Keys   config.NavigationKeys
+}
+
+// newPageOptions finds the device of a page layout and places its
+// navigation keys on it
+func newPageOptions(devices []config.DeviceProfile, layout config.PageLayout) (*pageOptions, error) {
+	device, err := findDeviceProfile(devices, layout.Device)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := layout.Keys(device)
+	if err != nil {
+		return nil, err
+	}
+	return &pageOptions{Device: device, Keys: keys}, nil
+}
+
+// layoutPages records the page and position of every entry and adds the
+// navigation keys, with their icons written to dir. Entries that fit on one
+// page fill it without navigation; otherwise every page keeps the
+// navigation keys free and the entries fill the other keys row by row.
+func layoutPages(media *MediaConfig, dir string, opts pageOptions, style config.BorderStyle, borderWidth int, output config.OutputSettings) error {
+	arrangePages(media, opts.Device, opts.Keys)
+	if len(media.Navigation) == 0 {
+		return nil
+	}
+
+	icons := map[string][2]string{}
+	for i, nav := range media.Navigation {
+		names, ok := icons[nav.Action]
+		if !ok {
+			var err error
+			if names, err = writeNavigationIcons(dir, nav.Action, style, borderWidth, output); err != nil {
+				return err
+			}
+			icons[nav.Action] = names
+		}
+		media.Navigation[i].Image, media.Navigation[i].ImagePressed = names[0], names[1]
+	}
+	return nil
+}
+
+// arrangePages assigns the pages and positions without touching any files
+func arrangePages(media *MediaConfig, device config.DeviceProfile, keys config.NavigationKeys) {
+	media.Device = device.Name
+	media.Navigation = nil
+
+	if len(media.Files) <= device.Keys() {
+		for i := range media.Files {
+			media.Files[i].Page, media.Files[i].Position = 1, i+1
+		}
+		return
+	}
+
+	reserved := map[int]bool{}
+	for _, slot := range keys.Slots() {
+		reserved[slot] = true
+	}
+	var free []int
+	for slot := 0; slot < device.Keys(); slot++ {
+		if !reserved[slot] {
+			free = append(free, slot)
+		}
+	}
+
+	for i := range media.Files {
+		media.Files[i].Page, media.Files[i].Position = i/len(free)+1, free[i%len(free)]+1
+	}
+
+	pages := (len(media.Files) + len(free) - 1) / len(free)
+	for page := 1; page <= pages; page++ {
+		for _, nav := range []struct {
+			action       string
+			slot, target int
+		}{
+			{navPrevious, keys.Previous, (page+pages-2)%pages + 1},
+			{navHome, keys.Home, 1},
+			{navNext, keys.Next, page%pages + 1},
+		} {
+			if nav.slot < 0 {
+				continue
+			}
+			media.Navigation = append(media.Navigation, NavigationKey{
+				Action:   nav.action,
+				Page:     page,
+				Position: nav.slot + 1,
+				Target:   nav.target,
+			})
+		}
+	}
+}
+
+// writeNavigationIcons draws the icon of a navigation action with its
+// pressed variant, bordered like the pressed images of the entries, and
+// returns their names
+func writeNavigationIcons(dir, action string, style config.BorderStyle, borderWidth int, output config.OutputSettings) ([2]string, error) {
+	ext := outputExtension(output, ".png")
+	names := [2]string{"nav_" + action + ext, "nav_" + action + "_pressed" + ext}
+
+	icon := navigationIcon(action, ThumbWidth)
+	if err := saveImage(icon, filepath.Join(dir, names[0]), output); err != nil {
+		return names, fmt.Errorf("failed to save %s icon: %v", action, err)
+	}
+	if err := createPressedImage(icon, filepath.Join(dir, names[1]), style, borderWidth, output); err != nil {
+		return names, fmt.Errorf("failed to save pressed %s icon: %v", action, err)
+	}
+	return names, nil
+}
+
+// navigationShapes outline the icons on a unit square
+var navigationShapes = map[string]func(x, y float64) bool{
+	navPrevious: func(x, y float64) bool {
+		return inTriangle(x, y, 0.65, 0.25, 0.3, 0.5, 0.65, 0.75)
+	},
+	navNext: func(x, y float64) bool {
+		return inTriangle(x, y, 0.35, 0.25, 0.7, 0.5, 0.35, 0.75)
+	},
+	navHome: func(x, y float64) bool {
+		roof := inTriangle(x, y, 0.5, 0.2, 0.82, 0.48, 0.18, 0.48)
+		walls := x >= 0.28 && x <= 0.72 && y >= 0.47 && y <= 0.8
+		door := x >= 0.44 && x <= 0.56 && y >= 0.62
+		return roof || walls && !door
+	},
+}
+
+// navigationIcon draws the shape of an action in white on a dark key,
+// sampling every pixel several times for smooth edges
+func navigationIcon(action string, size int) *image.NRGBA {
+	const samples = 4
+	background := color.NRGBA{R: 32, G: 32, B: 32, A: 255}
+	inside := navigationShapes[action]
+
+	img := imaging.New(size, size, background)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			covered := 0
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					u := (float64(x) + (float64(sx)+0.5)/samples) / float64(size)
+					v := (float64(y) + (float64(sy)+0.5)/samples) / float64(size)
+					if inside(u, v) {
+						covered++
+					}
+				}
+			}
+			if covered == 0 {
+				continue
+			}
+			blend := func(c uint8) uint8 {
+				return uint8((int(c)*(samples*samples-covered) + 255*covered) / (samples * samples))
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: blend(background.R), G: blend(background.G), B: blend(background.B), A: 255})
+		}
+	}
+	return img
+}
+
+// inTriangle reports whether (x, y) lies inside the triangle of the three
+// points, in either winding
+func inTriangle(x, y, x1, y1, x2, y2, x3, y3 float64) bool {
+	side := func(ax, ay, bx, by float64) float64 {
+		return (bx-ax)*(y-ay) - (by-ay)*(x-ax)
+	}
+	d1, d2, d3 := side(x1, y1, x2, y2), side(x2, y2, x3, y3), side(x3, y3, x1, y1)
+	negative := d1 < 0 || d2 < 0 || d3 < 0
+	positive := d1 > 0 || d2 > 0 || d3 > 0
+	return !(negative && positive)
+}
+
+// deckKey is what one key of a page holds: the index of an entry in Files,
+// a navigation key, or neither for a blank key
+type deckKey struct {
+	Nav   *NavigationKey
+	Entry int
+}
+
+// deckPages arranges the keys of a config on the pages of a device, at
+// their recorded positions when the config was laid out for that device and
+// row by row otherwise. There is always at least one page.
+func deckPages(media *MediaConfig, device config.DeviceProfile) [][]deckKey {
+	if pages, ok := recordedPages(media, device); ok {
+		return pages
+	}
+
+	count := max((len(media.Files)+device.Keys()-1)/device.Keys(), 1)
+	pages := newDeckPages(count, device)
+	for i := range media.Files {
+		pages[i/device.Keys()][i%device.Keys()].Entry = i
+	}
+	return pages
+}
+
+// recordedPages places the keys at their pages and positions, if they were
+// laid out for the device and no two of them share a key
+func recordedPages(media *MediaConfig, device config.DeviceProfile) ([][]deckKey, bool) {
+	if media.Device == "" || !strings.EqualFold(media.Device, device.Name) {
+		return nil, false
+	}
+
+	count := 1
+	for _, entry := range media.Files {
+		count = max(count, entry.Page)
+	}
+	for _, nav := range media.Navigation {
+		count = max(count, nav.Page)
+	}
+	pages := newDeckPages(count, device)
+
+	place := func(page, position int) (*deckKey, bool) {
+		if page < 1 || position < 1 || position > device.Keys() {
+			return nil, false
+		}
+		key := &pages[page-1][position-1]
+		return key, key.Entry < 0 && key.Nav == nil
+	}
+	for i, entry := range media.Files {
+		key, ok := place(entry.Page, entry.Position)
+		if !ok {
+			return nil, false
+		}
+		key.Entry = i
+	}
+	for i, nav := range media.Navigation {
+		key, ok := place(nav.Page, nav.Position)
+		if !ok {
+			return nil, false
+		}
+		key.Nav = &media.Navigation[i]
+	}
+	return pages, true
+}
+
+func newDeckPages(count int, device config.DeviceProfile) [][]deckKey {
+	pages := make([][]deckKey, count)
+	for p := range pages {
+		pages[p] = make([]deckKey, device.Keys())
+		for slot := range pages[p] {
+			pages[p][slot].Entry = -1
+		}
+	}
+	return pages
+}
+
+// layoutCmd splits the entries of a prepared folder into pages of a device
+func layoutCmd(args []string) int {
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	layout := cfg.PageLayout
+
+	fs := flag.NewFlagSet("layout", flag.ContinueOnError)
+	fs.StringVar(&layout.Device, "device", layout.Device, "device profile to lay the pages out for (default: the first one)")
+	fs.IntVar(&layout.Previous, "previous", layout.Previous, "key number of the previous page key, 0 for the default, -1 for none")
+	fs.IntVar(&layout.Home, "home", layout.Home, "key number of the home key, 0 for the default, -1 for none")
+	fs.IntVar(&layout.Next, "next", layout.Next, "key number of the next page key, 0 for the default, -1 for none")
+	borderName := fs.String("border-style", "Solid", "name of the border style of pressed icons")
+	borderColor := fs.String("border-color", cfg.BorderColor, "color of the solid border style")
+	borderWidth := fs.Int("border-width", cfg.BorderWidth, "border width of pressed icons in pixels")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck layout [flags] <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder. Keys are numbered from 1 at the top left, row by row.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts, err := newPageOptions(cfg.Devices(), layout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	style, err := findBorderStyle(cfg.BorderStyles, *borderName, *borderColor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err := newBorderPainter(style, *borderWidth, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid border style: %v\n", err)
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	if err := layoutPages(media, dir, *opts, style, *borderWidth, cfg.Output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error laying out pages: %v\n", err)
+		return 1
+	}
+	path, err := jsonExporter{}.Export(*media, dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("%d entries on %d pages of a %s saved to %s\n",
+		len(media.Files), len(deckPages(media, opts.Device)), opts.Device.Name, path)
+	return 0
+}
@@ -13,17 +13,31 @@ import (
 	"strings"
 
 	"github.com/buffos/cli-prepare-for-streamdeck/config"
-	"github.com/disintegration/imaging"
+	"github.com/buffos/cli-prepare-for-streamdeck/osc"
 )
 
 const ThumbWidth = 144
 
+// OscCommand is one OSC message. OscTypeTags holds the OSC type tag of each
+// value in OscValue (i, f, s, T or F), since JSON does not keep ints and
+// floats apart. OscTransport is "udp", "tcp-slip" or "tcp-length-prefixed".
 type OscCommand struct {
-	OscPath  string `json:"osc_path"`
-	OscValue []any  `json:"osc_value"`
-	OscPort  int    `json:"osc_port"`
+	OscPath      string        `json:"osc_path"`
+	OscTypeTags  string        `json:"osc_type_tags"`
+	OscHost      string        `json:"osc_host"`
+	OscTransport osc.Transport `json:"osc_transport"`
+	OscValue     []any         `json:"osc_value"`
+	OscPort      int           `json:"osc_port"`
 }
 
+// MediaEntry is one generated key. Pressing it runs the OscCommands, then
+// the inline Scripts, then the script files in ScriptPaths, and Delays[i] is
+// the pause in milliseconds before step i of that list (see runEntry). With
+// Bundle set, the commands for each target go out as one OSC bundle whose
+// timetag is BundleDelay milliseconds after sending (immediate when zero) and
+// their delays become timetag offsets. Page and Position place the key on
+// the device the config was laid out for (see layoutPages), both counted
+// from 1, and are zero when it was not.
 type MediaEntry struct {
 	Title        string       `json:"title"`
 	Image        string       `json:"image"`
@@ -33,12 +47,63 @@ type MediaEntry struct {
 	Scripts      []string     `json:"scripts"`
 	ScriptPaths  []string     `json:"script_paths"`
 	Delays       []int        `json:"delays"`
+	BundleDelay  int          `json:"bundle_delay"`
+	Page         int          `json:"page,omitempty"`
+	Position     int          `json:"position,omitempty"`
+	Bundle       bool         `json:"bundle"`
 }
 
+// audioExtensions are the files prepared as audio entries, which get no
+// images
+var audioExtensions = []string{".mp3", ".wav", ".ogg", ".flac"}
+
+// MediaConfig holds the generated entries. Device is the device profile
+// the pages were laid out for, and Navigation the keys that switch between
+// them.
 type MediaConfig struct {
-	Files   []MediaEntry `json:"files"`
-	OscRoot string       `json:"osc_root_path"`
-	OscArg  []string     `json:"osc_arg"`
+	Files      []MediaEntry    `json:"files"`
+	OscRoot    string          `json:"osc_root_path"`
+	OscArg     []string        `json:"osc_arg"`
+	Device     string          `json:"device,omitempty"`
+	Navigation []NavigationKey `json:"navigation,omitempty"`
+}
+
+// mediaConfigName is the file the generated entries are written to
+const mediaConfigName = "media_config.json"
+
+// loadMediaConfig reads a generated config, given either the file or the
+// folder it was written to. It also returns the folder, which the image
+// names in the entries are relative to.
+func loadMediaConfig(path string) (*MediaConfig, string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, mediaConfigName)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var media MediaConfig
+	if err := json.Unmarshal(data, &media); err != nil {
+		return nil, "", fmt.Errorf("invalid %s: %v", filepath.Base(path), err)
+	}
+	return &media, filepath.Dir(path), nil
+}
+
+// prepareOptions holds the choices made for one run over a media folder.
+// TitleFromMetadata fills titles from EXIF or XMP, falling back to the file
+// name. Exporters are the output formats to write, media_config.json alone
+// when empty. Pages splits the entries into pages of a device, with
+// navigation keys, before they are exported.
+type prepareOptions struct {
+	OscOption         config.OscPrefixOption
+	BorderStyle       config.BorderStyle
+	Exporters         []Exporter
+	Pages             *pageOptions
+	Output            config.OutputSettings
+	MediaType         config.MediaType
+	BorderWidth       int
+	TitleFromMetadata bool
 }
 
 // hexToRGBA converts a hex color string (#RRGGBB) to color.RGBA
@@ -56,63 +121,52 @@ func hexToRGBA(hex string) (color.RGBA, error) {
 	return color.RGBA{r, g, b, 255}, nil
 }
 
-// addBorder adds a colored border to an image
-func addBorder(img image.Image, borderWidth int, borderColor color.RGBA) *image.NRGBA {
-	bounds := img.Bounds()
-	newWidth := bounds.Dx() + (borderWidth * 2)
-	newHeight := bounds.Dy() + (borderWidth * 2)
-
-	bordered := imaging.New(newWidth, newHeight, borderColor)
-
-	// Draw the original image in the center
-	bordered = imaging.Paste(bordered, img, image.Point{borderWidth, borderWidth})
-
-	return bordered
-}
-
 // createResizedImage creates a thumbnail with specified width maintaining aspect ratio
-func createResizedImage(sourcePath, targetPath string, width int) error {
-	// Open the source image
-	img, err := imaging.Open(sourcePath)
+// and returns it, so derived variants can be made without reading it back
+func createResizedImage(sourcePath, targetPath string, width int, output config.OutputSettings) (*image.NRGBA, error) {
+	resized, err := loadThumbnail(sourcePath, width)
 	if err != nil {
-		return fmt.Errorf("failed to open image: %v", err)
+		return nil, err
 	}
 
-	// Calculate new dimensions maintaining aspect ratio
-	bounds := img.Bounds()
-	ratio := float64(width) / float64(bounds.Dx())
-	height := int(float64(bounds.Dy()) * ratio)
-
-	// Resize the image
-	resized := imaging.Resize(img, width, height, imaging.Lanczos)
-
 	// Save the resized image
-	err = imaging.Save(resized, targetPath)
+	err = saveImage(resized, targetPath, output)
 	if err != nil {
-		return fmt.Errorf("failed to save resized image: %v", err)
+		return nil, fmt.Errorf("failed to save resized image: %v", err)
 	}
 
-	return nil
+	return resized, nil
 }
 
-func processMediaFiles(searchPath string, mediaType config.MediaType, oscOption config.OscPrefixOption, borderColorHex string, borderWidth int) error { // nolint:cyclop
+func processMediaFiles(searchPath string, opts prepareOptions) error { // nolint:cyclop
 	var entries []MediaEntry
 	var validExtensions []string
 	var fullPaths []string
 
-	// Convert hex color to RGBA
-	borderColor, err := hexToRGBA(borderColorHex)
+	// Validate the border style once for all files
+	if _, err := newBorderPainter(opts.BorderStyle, opts.BorderWidth, false); err != nil {
+		return fmt.Errorf("invalid border style: %v", err)
+	}
+
+	if err := checkOutputSettings(opts.Output); err != nil {
+		return fmt.Errorf("invalid output settings: %v", err)
+	}
+	oscBuilder, err := newOscBuilder(opts.OscOption)
 	if err != nil {
-		return fmt.Errorf("invalid border color: %v", err)
+		return fmt.Errorf("invalid OSC option: %v", err)
+	}
+
+	if opts.Output.Format == config.FormatWebP {
+		fmt.Println("WebP encoding is not available, writing PNG images instead")
 	}
 
-	switch mediaType {
+	switch opts.MediaType {
 	case config.ImageType:
-		validExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+		validExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff"}
 	case config.VideoType:
 		validExtensions = []string{".mp4", ".avi", ".mov", ".mkv"}
 	case config.AudioType:
-		validExtensions = []string{".mp3", ".wav", ".ogg", ".flac"}
+		validExtensions = audioExtensions
 	}
 
 	err = filepath.Walk(searchPath, func(path string, info fs.FileInfo, err error) error {
@@ -126,7 +180,7 @@ func processMediaFiles(searchPath string, mediaType config.MediaType, oscOption
 		ext := strings.ToLower(filepath.Ext(path))
 		for _, validExt := range validExtensions {
 			if ext == validExt {
-				entry := processFile(path, mediaType, len(entries), oscOption, borderColor, borderWidth)
+				entry := processFile(path, len(entries), opts, oscBuilder)
 				entries = append(entries, entry)
 				fullPaths = append(fullPaths, path)
 				break
@@ -139,72 +193,76 @@ func processMediaFiles(searchPath string, mediaType config.MediaType, oscOption
 		return fmt.Errorf("error walking through directory: %v", err)
 	}
 
-	config := MediaConfig{
+	media := MediaConfig{
 		Files:   entries,
 		OscRoot: "",
 		OscArg:  fullPaths,
 	}
 
-	jsonData, err := json.MarshalIndent(config, "", "    ")
-	if err != nil {
-		return fmt.Errorf("error creating JSON: %v", err)
+	fmt.Printf("Successfully processed %d files.\n", len(entries))
+	if opts.Pages != nil {
+		if err := layoutPages(&media, searchPath, *opts.Pages, opts.BorderStyle, opts.BorderWidth, opts.Output); err != nil {
+			return fmt.Errorf("error laying out pages: %v", err)
+		}
 	}
-
-	jsonPath := filepath.Join(searchPath, "media_config.json")
-	err = os.WriteFile(jsonPath, jsonData, 0644) // nolint:gosec
-	if err != nil {
-		return fmt.Errorf("error saving JSON file: %v", err)
+	exporters := opts.Exporters
+	if len(exporters) == 0 {
+		exporters = []Exporter{jsonExporter{}}
 	}
-
-	fmt.Printf("Successfully processed %d files. Configuration saved to %s\n", len(entries), jsonPath)
-	return nil
+	// One failing format does not stop the others
+	var errs []error
+	for _, exporter := range exporters {
+		path, err := exporter.Export(media, searchPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s export failed: %v", exporter.Name(), err))
+			continue
+		}
+		fmt.Printf("Saved %s output to %s\n", exporter.Name(), path)
+	}
+	return errors.Join(errs...)
 }
 
-func processFile(filePath string, mediaType config.MediaType, index int, oscOption config.OscPrefixOption, borderColor color.RGBA, borderWidth int) MediaEntry { // nolint:cyclop
+func processFile(filePath string, index int, opts prepareOptions, oscBuilder *oscBuilder) MediaEntry { // nolint:cyclop
 	fileName := filepath.Base(filePath)
 	fileNameWithoutExt := strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	ext := filepath.Ext(fileName)
 
-	// Ensure 2-digit index
-	indexStr := fmt.Sprintf("%02d", index+1)
-
-	var oscPath string
-	var oscValue int
-
-	if oscOption.AugmentIndex {
-		oscPath = fmt.Sprintf("%s%s", oscOption.Prefix, indexStr)
-	} else {
-		oscPath = oscOption.Prefix
-	}
-
-	if oscOption.ArgumentType == "serial" {
-		oscValue = oscOption.ArgumentBase + index
-	} else if oscOption.ArgumentType == "constant" {
-		oscValue = oscOption.ArgumentBase
+	title := fileNameWithoutExt
+	if opts.MediaType == config.ImageType && opts.TitleFromMetadata {
+		md, err := readImageMetadata(filePath)
+		if err != nil {
+			fmt.Printf("Error reading metadata for %s: %v\n", fileName, err)
+		} else if metaTitle := md.title(); metaTitle != "" {
+			title = metaTitle
+		}
 	}
 
-	oscCommand := OscCommand{
-		OscPath:  oscPath,
-		OscValue: []any{oscValue},
-		OscPort:  8000,
+	oscCommands, delays, err := oscBuilder.build(oscBuilder.templateData(filePath, title, index, opts.MediaType))
+	if err != nil {
+		fmt.Printf("Error building OSC commands for %s: %v\n", fileName, err)
+		oscCommands, delays = []OscCommand{}, []int{}
 	}
 
 	entry := MediaEntry{
-		Title:       fileNameWithoutExt,
-		OscCommands: []OscCommand{oscCommand},
+		Title:       title,
+		OscCommands: oscCommands,
 		FullPath:    filePath,
 		Scripts:     []string{},
 		ScriptPaths: []string{},
-		Delays:      []int{},
+		Delays:      delays,
+		Bundle:      opts.OscOption.Bundle,
+		BundleDelay: opts.OscOption.BundleDelay,
 	}
 
-	switch mediaType {
+	switch opts.MediaType {
 	case config.ImageType:
 		// Create thumbnail
+		ext = outputExtension(opts.Output, deckExtension(ext))
 		thumbName := fileNameWithoutExt + "_thumb" + ext
 		thumbPath := filepath.Join(filepath.Dir(filePath), thumbName)
 
-		if err := createResizedImage(filePath, thumbPath, ThumbWidth); err != nil {
+		thumb, err := createResizedImage(filePath, thumbPath, ThumbWidth, opts.Output)
+		if err != nil {
 			fmt.Printf("Error creating thumbnail for %s: %v\n", fileName, err)
 			return entry
 		}
@@ -215,7 +273,7 @@ func processFile(filePath string, mediaType config.MediaType, index int, oscOpti
 		pressedName := fileNameWithoutExt + "_pressed" + ext
 		pressedPath := filepath.Join(filepath.Dir(filePath), pressedName)
 
-		if err := createPressedImage(thumbPath, pressedPath, borderColor, borderWidth); err != nil {
+		if err := createPressedImage(thumb, pressedPath, opts.BorderStyle, opts.BorderWidth, opts.Output); err != nil {
 			fmt.Printf("Error creating pressed image for %s: %v\n", fileName, err)
 		} else {
 			entry.ImagePressed = pressedName
@@ -223,10 +281,12 @@ func processFile(filePath string, mediaType config.MediaType, index int, oscOpti
 
 	case config.VideoType:
 		// Create thumbnail from first frame
-		thumbName := fileNameWithoutExt + "_thumb.jpg"
+		ext = outputExtension(opts.Output, ".jpg")
+		thumbName := fileNameWithoutExt + "_thumb" + ext
 		thumbPath := filepath.Join(filepath.Dir(filePath), thumbName)
 
-		if err := extractVideoThumbnail(filePath, thumbPath); err != nil {
+		thumb, err := extractVideoThumbnail(filePath, thumbPath, opts.Output)
+		if err != nil {
 			fmt.Printf("Error extracting thumbnail for %s: %v\n", fileName, err)
 			return entry
 		}
@@ -234,10 +294,10 @@ func processFile(filePath string, mediaType config.MediaType, index int, oscOpti
 		entry.Image = thumbName
 
 		// Create pressed version from thumbnail
-		pressedName := fileNameWithoutExt + "_pressed.jpg"
+		pressedName := fileNameWithoutExt + "_pressed" + ext
 		pressedPath := filepath.Join(filepath.Dir(filePath), pressedName)
 
-		if err := createPressedImage(thumbPath, pressedPath, borderColor, borderWidth); err != nil {
+		if err := createPressedImage(thumb, pressedPath, opts.BorderStyle, opts.BorderWidth, opts.Output); err != nil {
 			fmt.Printf("Error creating pressed thumbnail for %s: %v\n", fileName, err)
 		} else {
 			entry.ImagePressed = pressedName
@@ -251,18 +311,19 @@ func processFile(filePath string, mediaType config.MediaType, index int, oscOpti
 	return entry
 }
 
-func createPressedImage(sourcePath, targetPath string, borderColor color.RGBA, borderWidth int) error {
-	// Open the source image
-	img, err := imaging.Open(sourcePath)
+// createPressedImage writes a thumbnail with the border style around it,
+// painted for the format of the target
+func createPressedImage(thumb image.Image, targetPath string, style config.BorderStyle, borderWidth int, output config.OutputSettings) error {
+	painter, err := newBorderPainter(style, borderWidth, !hasAlphaChannel(targetPath))
 	if err != nil {
-		return fmt.Errorf("failed to open image: %v", err)
+		return err
 	}
 
 	// Add border
-	bordered := addBorder(img, borderWidth, borderColor)
+	bordered := addBorder(thumb, borderWidth, painter)
 
 	// Save the bordered image
-	err = imaging.Save(bordered, targetPath)
+	err = saveImage(bordered, targetPath, output)
 	if err != nil {
 		return fmt.Errorf("failed to save bordered image: %v", err)
 	}
@@ -270,17 +331,20 @@ func createPressedImage(sourcePath, targetPath string, borderColor color.RGBA, b
 	return nil
 }
 
-func extractVideoThumbnail(videoPath, thumbnailPath string) error {
-	// Extract first frame using ffmpeg
-	cmd := exec.Command("ffmpeg", "-i", videoPath, "-vframes", "1", "-f", "image2", thumbnailPath)
+func extractVideoThumbnail(videoPath, thumbnailPath string, output config.OutputSettings) (*image.NRGBA, error) {
+	// Extract first frame using ffmpeg, letting it scale the frame down so
+	// full resolution video frames never have to be decoded here
+	scale := fmt.Sprintf("scale=%d:-2", ThumbWidth*2)
+	cmd := exec.Command("ffmpeg", "-y", "-i", videoPath, "-vframes", "1", "-vf", scale, "-f", "image2", thumbnailPath)
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to extract frame: %v", err)
+		return nil, fmt.Errorf("failed to extract frame: %v", err)
 	}
 
 	// Resize the extracted frame to thumbnail size
-	if err := createResizedImage(thumbnailPath, thumbnailPath, ThumbWidth); err != nil {
-		return fmt.Errorf("failed to resize video thumbnail: %v", err)
+	thumb, err := createResizedImage(thumbnailPath, thumbnailPath, ThumbWidth, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resize video thumbnail: %v", err)
 	}
 
-	return nil
+	return thumb, nil
 }
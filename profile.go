@@ -0,0 +1,309 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+const (
+	profileExtension = ".streamDeckProfile"
+	profileVersion   = "2.0"
+)
+
+// sdProfileManifest is the top manifest of a profile, listing its pages
+type sdProfileManifest struct {
+	Device  sdDevice `json:"Device"`
+	Name    string   `json:"Name"`
+	Pages   sdPages  `json:"Pages"`
+	Version string   `json:"Version"`
+}
+
+type sdDevice struct {
+	Model string `json:"Model"`
+	UUID  string `json:"UUID"`
+}
+
+type sdPages struct {
+	Current string   `json:"Current"`
+	Pages   []string `json:"Pages"`
+}
+
+// sdPageManifest is the manifest of one page. Actions are keyed by
+// "column,row".
+type sdPageManifest struct {
+	Controllers []sdController `json:"Controllers"`
+	Name        string         `json:"Name"`
+}
+
+type sdController struct {
+	Actions map[string]sdAction `json:"Actions"`
+	Type    string              `json:"Type"`
+}
+
+type sdAction struct {
+	Settings map[string]any `json:"Settings"`
+	Name     string         `json:"Name"`
+	UUID     string         `json:"UUID"`
+	States   []sdState      `json:"States"`
+	State    int            `json:"State"`
+}
+
+type sdState struct {
+	Image          string `json:"Image,omitempty"`
+	Title          string `json:"Title"`
+	TitleAlignment string `json:"TitleAlignment"`
+	FontSize       int    `json:"FontSize"`
+	ShowTitle      bool   `json:"ShowTitle"`
+}
+
+// exportProfileCmd writes a .streamDeckProfile archive for a prepared folder
+func exportProfileCmd(args []string) int {
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	settings := cfg.StreamDeckProfile
+
+	fs := flag.NewFlagSet("export-profile", flag.ContinueOnError)
+	fs.StringVar(&settings.Device, "device", settings.Device, "device profile to lay the keys out for (default: the one the pages are laid out for, or the first one)")
+	fs.StringVar(&settings.ActionUUID, "action-uuid", settings.ActionUUID, "UUID of the action placed on every key")
+	fs.StringVar(&settings.ActionName, "action-name", settings.ActionName, "name of the action placed on every key")
+	name := fs.String("name", "", "profile name (default: the folder name)")
+	out := fs.String("out", "", "file to write (default: <name>"+profileExtension+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck export-profile [flags] <config>")
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+	device, err := mediaDeviceProfile(cfg.Devices(), media, settings.Device)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *name == "" {
+		*name = filepath.Base(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			*name = filepath.Base(abs)
+		}
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, *name+profileExtension)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating profile: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	if err := exportStreamDeckProfile(file, media, dir, *name, device, settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing profile: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Profile with %d entries for the %s saved to %s\n", len(media.Files), device.Name, path)
+	return 0
+}
+
+// exportStreamDeckProfile writes the entries as a Stream Deck profile
+// archive: a manifest for the profile, and a manifest plus key images for
+// every page of the device grid. Every key gets the configured action, whose
+// settings carry the media file path and the entry's OSC commands, and the
+// navigation keys of a paged layout get the app's page actions.
+func exportStreamDeckProfile(w io.Writer, media *MediaConfig, dir, name string, device config.DeviceProfile, settings config.StreamDeckProfileSettings) error {
+	// Keys without a configured action open their media file
+	defaults := config.DefaultStreamDeckProfileSettings
+	if settings.ActionUUID == "" {
+		settings.ActionUUID = defaults.ActionUUID
+	}
+	if settings.ActionName == "" && settings.ActionUUID == defaults.ActionUUID {
+		settings.ActionName = defaults.ActionName
+	}
+
+	profileID := newProfileUUID()
+	root := profileID + ".sdProfile/"
+
+	pages := deckPages(media, device)
+	manifest := sdProfileManifest{
+		Device:  sdDevice{Model: device.Model},
+		Name:    name,
+		Version: profileVersion,
+	}
+	for range pages {
+		manifest.Pages.Pages = append(manifest.Pages.Pages, newProfileUUID())
+	}
+	manifest.Pages.Current = manifest.Pages.Pages[0]
+
+	archive := zip.NewWriter(w)
+	if err := writeZipJSON(archive, root+"manifest.json", manifest); err != nil {
+		return err
+	}
+
+	for p, pageID := range manifest.Pages.Pages {
+		pageDir := root + "Profiles/" + pageID + "/"
+		keypad := sdController{Type: "Keypad", Actions: map[string]sdAction{}}
+
+		// addImage copies a key image into the page, reporting a missing one
+		addImage := func(state *sdState, label, image, zipName string) error {
+			if image == "" {
+				return nil
+			}
+			source := filepath.Join(dir, image)
+			if _, err := os.Stat(source); err != nil {
+				fmt.Printf("Warning: %s has no key image: %v\n", label, err)
+				return nil
+			}
+			zipName += strings.ToLower(filepath.Ext(image))
+			if err := copyToZip(archive, pageDir+zipName, source); err != nil {
+				return err
+			}
+			state.Image = zipName
+			return nil
+		}
+
+		for slot, held := range pages[p] {
+			key := fmt.Sprintf("%d,%d", slot%device.Cols, slot/device.Cols)
+
+			if nav := held.Nav; nav != nil {
+				state := sdState{TitleAlignment: "bottom", FontSize: 9}
+				if err := addImage(&state, nav.describe(), nav.Image, "Images/nav_"+nav.Action); err != nil {
+					return err
+				}
+				keypad.Actions[key] = profileNavigationAction(*nav, state)
+				continue
+			}
+			if held.Entry < 0 {
+				continue
+			}
+
+			entry := media.Files[held.Entry]
+			state := sdState{Title: entry.Title, TitleAlignment: "bottom", FontSize: 9, ShowTitle: true}
+			if err := addImage(&state, entry.Title, entry.Image, fmt.Sprintf("Images/%d", held.Entry+1)); err != nil {
+				return err
+			}
+
+			keypad.Actions[key] = sdAction{
+				Name:     settings.ActionName,
+				UUID:     settings.ActionUUID,
+				States:   []sdState{state},
+				Settings: profileActionSettings(entry),
+			}
+		}
+
+		page := sdPageManifest{Name: fmt.Sprintf("Page %d", p+1), Controllers: []sdController{keypad}}
+		if err := writeZipJSON(archive, pageDir+"manifest.json", page); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// profileNavigationAction is the Stream Deck page action of a navigation
+// key. Home goes to its target page, the first.
+func profileNavigationAction(nav NavigationKey, state sdState) sdAction {
+	action := sdAction{States: []sdState{state}, Settings: map[string]any{}}
+	switch nav.Action {
+	case navPrevious:
+		action.Name, action.UUID = "Previous Page", "com.elgato.streamdeck.page.previous"
+	case navNext:
+		action.Name, action.UUID = "Next Page", "com.elgato.streamdeck.page.next"
+	default:
+		action.Name, action.UUID = "Go to Page", "com.elgato.streamdeck.page.goto"
+		action.Settings["page"] = nav.Target
+	}
+	return action
+}
+
+// profileActionSettings are the settings of a key's action. path is what the
+// Open action opens; plugins that understand OSC can use osc_commands.
+func profileActionSettings(entry MediaEntry) map[string]any {
+	settings := map[string]any{"path": entry.FullPath}
+	if len(entry.OscCommands) > 0 {
+		settings["osc_commands"] = entry.OscCommands
+	}
+	return settings
+}
+
+func writeZipJSON(archive *zip.Writer, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", name, err)
+	}
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func copyToZip(archive *zip.Writer, name, source string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	return err
+}
+
+// newProfileUUID returns a random version 4 UUID in the upper case the
+// Stream Deck app uses
+func newProfileUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0F | 0x40
+	b[8] = b[8]&0x3F | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// profileExporter writes a .streamDeckProfile laid out for the configured device
+type profileExporter struct {
+	devices  []config.DeviceProfile
+	settings config.StreamDeckProfileSettings
+}
+
+func (profileExporter) Name() string      { return "streamdeck-profile" }
+func (profileExporter) Extension() string { return profileExtension }
+
+func (e profileExporter) Export(media MediaConfig, outDir string) (string, error) {
+	device, err := mediaDeviceProfile(e.devices, &media, e.settings.Device)
+	if err != nil {
+		return "", err
+	}
+	name := exportName(outDir)
+	return exportFile(filepath.Join(outDir, name+profileExtension), func(w io.Writer) error {
+		return exportStreamDeckProfile(w, &media, outDir, name, device, e.settings)
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// profileArchive is an exported profile read back by file name
+type profileArchive map[string][]byte
+
+func readProfileArchive(t *testing.T, data []byte) profileArchive {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := profileArchive{}
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = content
+	}
+	return files
+}
+
+// manifest finds the profile manifest and returns it with the folder of
+// the profile
+func (a profileArchive) manifest(t *testing.T) (sdProfileManifest, string) {
+	t.Helper()
+	var manifest sdProfileManifest
+	for name, content := range a {
+		root, ok := strings.CutSuffix(name, "manifest.json")
+		if !ok || strings.Contains(root, "/Profiles/") {
+			continue
+		}
+		if !strings.HasSuffix(root, ".sdProfile/") || strings.Count(root, "/") != 1 {
+			t.Fatalf("profile manifest at %s", name)
+		}
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		return manifest, root
+	}
+	t.Fatal("no profile manifest")
+	return manifest, ""
+}
+
+func (a profileArchive) page(t *testing.T, root, pageID string) sdPageManifest {
+	t.Helper()
+	content, ok := a[root+"Profiles/"+pageID+"/manifest.json"]
+	if !ok {
+		t.Fatalf("no manifest for page %s", pageID)
+	}
+	var page sdPageManifest
+	if err := json.Unmarshal(content, &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Controllers) != 1 || page.Controllers[0].Type != "Keypad" {
+		t.Fatalf("page %s has controllers %+v", pageID, page.Controllers)
+	}
+	return page
+}
+
+// writeKeyImages creates image files whose content is their name
+func writeKeyImages(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportStreamDeckProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyImages(t, dir, "intro_thumb.png", "loop_thumb.jpg", "outro_thumb.png")
+
+	media := &MediaConfig{Files: []MediaEntry{
+		{Title: "Intro", FullPath: "/show/intro.png", Image: "intro_thumb.png"},
+		{Title: "Loop", FullPath: "/show/loop.jpg", Image: "loop_thumb.jpg", OscCommands: []OscCommand{{OscPath: "/clip/2"}}},
+		{Title: "Song", FullPath: "/show/song.mp3"},
+		{Title: "Outro", FullPath: "/show/outro.png", Image: "outro_thumb.png"},
+	}}
+	device := config.DefaultDeviceProfiles[1] // Stream Deck Mini, 3 columns
+	settings := config.StreamDeckProfileSettings{Device: device.Name, ActionName: "Launch"}
+
+	var buf bytes.Buffer
+	if err := exportStreamDeckProfile(&buf, media, dir, "Show", device, settings); err != nil {
+		t.Fatal(err)
+	}
+	archive := readProfileArchive(t, buf.Bytes())
+
+	manifest, root := archive.manifest(t)
+	if manifest.Name != "Show" || manifest.Device.Model != device.Model || manifest.Version != profileVersion {
+		t.Errorf("manifest is %+v", manifest)
+	}
+	if len(manifest.Pages.Pages) != 1 || manifest.Pages.Current != manifest.Pages.Pages[0] {
+		t.Fatalf("pages are %+v, want one current page", manifest.Pages)
+	}
+	pageID := manifest.Pages.Pages[0]
+	actions := archive.page(t, root, pageID).Controllers[0].Actions
+
+	// Keys are numbered "column,row" from the top left
+	want := map[string]struct{ title, image string }{
+		"0,0": {"Intro", "Images/1.png"},
+		"1,0": {"Loop", "Images/2.jpg"},
+		"2,0": {"Song", ""},
+		"0,1": {"Outro", "Images/4.png"},
+	}
+	if len(actions) != len(want) {
+		t.Errorf("page has %d actions, want %d", len(actions), len(want))
+	}
+	for key, w := range want {
+		action, ok := actions[key]
+		if !ok {
+			t.Errorf("no action at %s", key)
+			continue
+		}
+		if action.UUID != config.DefaultStreamDeckProfileSettings.ActionUUID || action.Name != "Launch" {
+			t.Errorf("%s: action %s %q, want the default UUID named Launch", key, action.UUID, action.Name)
+		}
+		state := action.States[0]
+		if state.Title != w.title || state.Image != w.image {
+			t.Errorf("%s: state %q with image %q, want %q with %q", key, state.Title, state.Image, w.title, w.image)
+		}
+		if w.image == "" {
+			continue
+		}
+		if _, ok := archive[root+"Profiles/"+pageID+"/"+w.image]; !ok {
+			t.Errorf("%s: image %s is not in the archive", key, w.image)
+		}
+	}
+
+	images := 0
+	for name := range archive {
+		if strings.Contains(name, "/Images/") {
+			images++
+		}
+	}
+	if images != 3 {
+		t.Errorf("archive has %d images, want 3", images)
+	}
+	if got := string(archive[root+"Profiles/"+pageID+"/Images/2.jpg"]); got != "loop_thumb.jpg" {
+		t.Errorf("image of key 2 holds %q", got)
+	}
+	if actions["1,0"].Settings["osc_commands"] == nil || actions["1,0"].Settings["path"] != "/show/loop.jpg" {
+		t.Errorf("settings of key 2 are %v", actions["1,0"].Settings)
+	}
+}
+
+func TestExportStreamDeckProfilePages(t *testing.T) {
+	dir := t.TempDir()
+	device := config.DefaultDeviceProfiles[1]
+	keys, err := config.PageLayout{}.Keys(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media := &MediaConfig{}
+	for i := 1; i <= device.Keys()+1; i++ {
+		media.Files = append(media.Files, MediaEntry{Title: fmt.Sprintf("Clip %d", i)})
+	}
+	arrangePages(media, device, keys)
+	for i := range media.Navigation {
+		media.Navigation[i].Image = "nav_" + media.Navigation[i].Action + ".png"
+	}
+	writeKeyImages(t, dir, "nav_previous.png", "nav_home.png", "nav_next.png")
+
+	var buf bytes.Buffer
+	if err := exportStreamDeckProfile(&buf, media, dir, "Show", device, config.StreamDeckProfileSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	archive := readProfileArchive(t, buf.Bytes())
+	manifest, root := archive.manifest(t)
+
+	pages := deckPages(media, device)
+	if len(manifest.Pages.Pages) != len(pages) || len(pages) < 2 {
+		t.Fatalf("profile has %d pages, layout has %d", len(manifest.Pages.Pages), len(pages))
+	}
+
+	for p, pageID := range manifest.Pages.Pages {
+		actions := archive.page(t, root, pageID).Controllers[0].Actions
+		for slot, held := range pages[p] {
+			key := fmt.Sprintf("%d,%d", slot%device.Cols, slot/device.Cols)
+			action, ok := actions[key]
+			switch {
+			case held.Nav != nil:
+				if !ok || !strings.HasPrefix(action.UUID, "com.elgato.streamdeck.page.") {
+					t.Errorf("page %d key %s: %+v, want a page action", p+1, key, action)
+					continue
+				}
+				image := "Images/nav_" + held.Nav.Action + ".png"
+				if action.States[0].Image != image {
+					t.Errorf("page %d key %s: image %q, want %q", p+1, key, action.States[0].Image, image)
+				}
+				if _, ok := archive[root+"Profiles/"+pageID+"/"+image]; !ok {
+					t.Errorf("page %d: %s is not in the archive", p+1, image)
+				}
+			case held.Entry >= 0:
+				if !ok || action.States[0].Title != media.Files[held.Entry].Title {
+					t.Errorf("page %d key %s: %+v, want %q", p+1, key, action, media.Files[held.Entry].Title)
+				}
+				if action.Name != config.DefaultStreamDeckProfileSettings.ActionName {
+					t.Errorf("page %d key %s: action %q, want the default", p+1, key, action.Name)
+				}
+			case ok:
+				t.Errorf("page %d key %s: unexpected action %+v", p+1, key, action)
+			}
+		}
+	}
+}
+
+func TestMediaDeviceProfile(t *testing.T) {
+	devices := config.DefaultDeviceProfiles
+	first, mini, xl := devices[0].Name, devices[1].Name, devices[2].Name
+
+	tests := map[string]struct {
+		laidOut string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		"no pages":          {want: first},
+		"named":             {name: xl, want: xl},
+		"pages":             {laidOut: mini, want: mini},
+		"pages named":       {laidOut: mini, name: strings.ToUpper(mini), want: mini},
+		"other device":      {laidOut: mini, name: xl, want: xl},
+		"unknown layout":    {laidOut: "Stream Deck Pedal", want: first},
+		"unknown name":      {laidOut: mini, name: "Stream Deck Pedal", wantErr: true},
+		"first for no page": {name: first, want: first},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			device, err := mediaDeviceProfile(devices, &MediaConfig{Device: tt.laidOut}, tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("picked %s, want an error", device.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if device.Name != tt.want {
+				t.Errorf("picked %s, want %s", device.Name, tt.want)
+			}
+		})
+	}
+}
+
+// TestProfileExporterUsesLayoutDevice checks that a paged config is exported
+// for the device its pages were laid out for, not the first profile
+func TestProfileExporterUsesLayoutDevice(t *testing.T) {
+	dir := t.TempDir()
+	media, device := pagedMedia(t, 8)
+	writeKeyImages(t, dir, "nav_previous.png", "nav_home.png", "nav_next.png",
+		"nav_previous_pressed.png", "nav_home_pressed.png", "nav_next_pressed.png")
+
+	exporter := profileExporter{devices: config.DefaultDeviceProfiles}
+	path, err := exporter.Export(*media, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ := readProfileArchive(t, data).manifest(t)
+	if manifest.Device.Model != device.Model {
+		t.Errorf("profile is for %s, want the %s of the layout (%s)", manifest.Device.Model, device.Name, device.Model)
+	}
+	if got, want := len(manifest.Pages.Pages), len(deckPages(media, device)); got != want {
+		t.Errorf("profile has %d pages, want %d", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+
+	"github.com/disintegration/imaging"
+
+	// Register decoders for source formats the standard library lacks
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// loadThumbnail decodes a source image once and returns it scaled to the
+// given width, maintaining aspect ratio. The decoded image is shrunk before
+// anything else copies it: a baseline JPEG stays in its YCbCr planes, about
+// 1.5 bytes per pixel, and the EXIF orientation is applied to the shrunk
+// image instead of a full-size rotated copy.
+func loadThumbnail(sourcePath string, width int) (*image.NRGBA, error) {
+	// Phone photos are often stored sideways with an EXIF orientation tag
+	md, err := readImageMetadata(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	img, err := imaging.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	// The target width applies to the image as it is shown
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if md.Orientation >= orientationTranspose {
+		w, h = h, w
+	}
+	if factor := shrinkFactor(w, h, width); factor > 1 {
+		img = shrinkImage(img, factor)
+	}
+
+	return imaging.Resize(orient(img, md.Orientation), width, scaledHeight(w, h, width), imaging.Lanczos), nil
+}
+
+// orient turns an image the way its EXIF orientation says it is shown
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case orientationTranspose:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// resizeToWidth scales an image to the given width. Large images are first
+// shrunk with a cheap box filter by the largest power of two that keeps them
+// at least twice the target width, so the final Lanczos pass only runs on a
+// small image.
+func resizeToWidth(img image.Image, width int) *image.NRGBA {
+	bounds := img.Bounds()
+	// The height comes from the source, as shrinking rounds its size down
+	height := scaledHeight(bounds.Dx(), bounds.Dy(), width)
+	if factor := shrinkFactor(bounds.Dx(), bounds.Dy(), width); factor > 1 {
+		img = shrinkImage(img, factor)
+	}
+	return imaging.Resize(img, width, height, imaging.Lanczos)
+}
+
+// scaledHeight is the height of a w x h image scaled to width, rounded to
+// the nearest pixel
+func scaledHeight(w, h, width int) int {
+	return max((h*width+w/2)/w, 1)
+}
+
+// shrinkFactor is the power of two a w x h image can be shrunk by while
+// staying at least twice the target width
+func shrinkFactor(w, h, width int) int {
+	factor := 1
+	for w/(factor*2) >= width*2 && h/(factor*2) >= 2 {
+		factor *= 2
+	}
+	return factor
+}
+
+// shrinkImage downscales an image by factor in each direction, averaging
+// every factor x factor block. Source rows are converted one at a time into
+// running sums, so memory beyond the result is a few rows of the source.
+func shrinkImage(src image.Image, factor int) *image.NRGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx()/factor, bounds.Dy()/factor
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	row := make([]uint8, bounds.Dx()*4)
+	// Colour channels are summed weighted by alpha so transparent pixels do
+	// not darken the edges
+	sums := make([]uint64, width*4)
+	count := uint64(factor * factor)
+	for y := 0; y < height; y++ {
+		clear(sums)
+		for dy := 0; dy < factor; dy++ {
+			readRow(src, bounds.Min.Y+y*factor+dy, row)
+			for x := 0; x < width*factor; x++ {
+				i, s := x*4, x/factor*4
+				a := uint64(row[i+3])
+				sums[s] += uint64(row[i]) * a
+				sums[s+1] += uint64(row[i+1]) * a
+				sums[s+2] += uint64(row[i+2]) * a
+				sums[s+3] += a
+			}
+		}
+
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+width*4]
+		for x := 0; x < width; x++ {
+			s := x * 4
+			a := sums[s+3]
+			if a == 0 {
+				continue
+			}
+			out[s] = uint8((sums[s] + a/2) / a)
+			out[s+1] = uint8((sums[s+1] + a/2) / a)
+			out[s+2] = uint8((sums[s+2] + a/2) / a)
+			out[s+3] = uint8((a + count/2) / count)
+		}
+	}
+
+	return dst
+}
+
+// readRow converts one row of an image into non-premultiplied RGBA bytes
+func readRow(src image.Image, y int, row []uint8) {
+	bounds := src.Bounds()
+
+	switch img := src.(type) {
+	case *image.NRGBA:
+		start := img.PixOffset(bounds.Min.X, y)
+		copy(row, img.Pix[start:start+bounds.Dx()*4])
+
+	case *image.YCbCr:
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yi := img.YOffset(x, y)
+			ci := img.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+			i := (x - bounds.Min.X) * 4
+			row[i], row[i+1], row[i+2], row[i+3] = r, g, b, 255
+		}
+
+	default:
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			i := (x - bounds.Min.X) * 4
+			row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
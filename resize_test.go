@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// writeBenchmarkJPEG writes a 24 megapixel photo-like JPEG, the size of a
+// current camera's output
+func writeBenchmarkJPEG(b *testing.B) string {
+	b.Helper()
+	const width, height = 6000, 4000
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i] = uint8(x * 255 / width)
+			img.Pix[i+1] = uint8(y * 255 / height)
+			img.Pix[i+2] = uint8((x ^ y) & 0xFF)
+			img.Pix[i+3] = 255
+		}
+	}
+
+	path := filepath.Join(b.TempDir(), "source.jpg")
+	file, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 90}); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkThumbnailLanczos is the path loadThumbnail replaced: opening the
+// source with imaging.Open and running Lanczos over the full image
+func BenchmarkThumbnailLanczos(b *testing.B) {
+	path := writeBenchmarkJPEG(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		img, err := imaging.Open(path, imaging.AutoOrientation(true))
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = imaging.Resize(img, ThumbWidth, 0, imaging.Lanczos)
+	}
+}
+
+// BenchmarkThumbnailStepped decodes once and shrinks the image with
+// shrinkImage before the final Lanczos pass of resizeToWidth
+func BenchmarkThumbnailStepped(b *testing.B) {
+	path := writeBenchmarkJPEG(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := loadThumbnail(path, ThumbWidth); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkShrinkImage measures the box filter step on a decoded source
+func BenchmarkShrinkImage(b *testing.B) {
+	img := imaging.New(6000, 4000, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = shrinkImage(img, 16)
+	}
+}
+
+func TestShrinkImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	set := func(x, y int, c color.NRGBA) { src.SetNRGBA(x, y, c) }
+	// Left block: two black and two white pixels average to mid grey
+	set(0, 0, color.NRGBA{A: 255})
+	set(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	set(0, 1, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	set(1, 1, color.NRGBA{A: 255})
+	// Right block: one red pixel and three transparent black ones, which
+	// must not darken it
+	set(2, 0, color.NRGBA{R: 200, A: 255})
+
+	dst := shrinkImage(src, 2)
+	if dst.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("shrunk to %v, want 2x1", dst.Bounds())
+	}
+	if got, want := dst.NRGBAAt(0, 0), (color.NRGBA{R: 128, G: 128, B: 128, A: 255}); got != want {
+		t.Errorf("grey block is %v, want %v", got, want)
+	}
+	if got, want := dst.NRGBAAt(1, 0), (color.NRGBA{R: 200, A: 64}); got != want {
+		t.Errorf("red block is %v, want %v", got, want)
+	}
+}
+
+func TestShrinkImageSubImage(t *testing.T) {
+	// Sub-images start away from the origin; only their own pixels count
+	full := imaging.New(8, 8, color.NRGBA{B: 255, A: 255})
+	inner := imaging.New(4, 4, color.NRGBA{G: 255, A: 255})
+	full = imaging.Paste(full, inner, image.Pt(4, 4))
+
+	dst := shrinkImage(full.SubImage(image.Rect(4, 4, 8, 8)), 4)
+	if got, want := dst.NRGBAAt(0, 0), (color.NRGBA{G: 255, A: 255}); got != want {
+		t.Errorf("sub-image shrank to %v, want %v", got, want)
+	}
+}
+
+func TestResizeToWidth(t *testing.T) {
+	tests := []struct {
+		w, h, width, height int
+	}{
+		{6000, 4000, 72, 48},
+		{4000, 6000, 72, 108},
+		{100, 50, 72, 36},
+		{30, 30, 72, 72}, // small sources are enlarged
+	}
+	for _, tt := range tests {
+		src := imaging.New(tt.w, tt.h, color.NRGBA{R: 10, G: 200, B: 30, A: 255})
+		dst := resizeToWidth(src, tt.width)
+		if dst.Bounds().Dx() != tt.width || dst.Bounds().Dy() != tt.height {
+			t.Errorf("%dx%d resized to %v, want %dx%d", tt.w, tt.h, dst.Bounds(), tt.width, tt.height)
+			continue
+		}
+		// A flat colour stays flat through both filters
+		if got := dst.NRGBAAt(tt.width/2, tt.height/2); got != (color.NRGBA{R: 10, G: 200, B: 30, A: 255}) {
+			t.Errorf("%dx%d: centre is %v", tt.w, tt.h, got)
+		}
+	}
+}
+
+func TestShrinkFactor(t *testing.T) {
+	tests := []struct{ w, h, width, want int }{
+		{6000, 4000, 72, 32},
+		{287, 287, 72, 1},
+		{288, 288, 72, 2},
+		{10000, 3, 72, 1}, // too flat to halve
+	}
+	for _, tt := range tests {
+		if got := shrinkFactor(tt.w, tt.h, tt.width); got != tt.want {
+			t.Errorf("shrinkFactor(%d, %d, %d) = %d, want %d", tt.w, tt.h, tt.width, got, tt.want)
+		}
+	}
+}
+
+// withOrientation inserts an EXIF segment with an orientation tag after the
+// start of a JPEG
+func withOrientation(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0,
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0,
+		0, 0, 0, 0}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	return append(append(append([]byte{}, jpegData[:2]...), segment...), jpegData[2:]...)
+}
+
+func TestLoadThumbnailOrientation(t *testing.T) {
+	// Stored 400x200 with the left half red and the right half blue
+	src := imaging.New(400, 200, color.NRGBA{B: 255, A: 255})
+	src = imaging.Paste(src, imaging.New(200, 200, color.NRGBA{R: 255, A: 255}), image.Pt(0, 0))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	isRed := func(c color.NRGBA) bool { return c.R > 200 && c.B < 60 }
+	isBlue := func(c color.NRGBA) bool { return c.B > 200 && c.R < 60 }
+
+	tests := []struct {
+		orientation   uint16
+		width, height int
+		first, second image.Point
+		firstRed      bool
+	}{
+		{1, 40, 20, image.Pt(5, 10), image.Pt(35, 10), true},
+		// Shown turned clockwise: the left half ends up on top
+		{6, 40, 80, image.Pt(20, 10), image.Pt(20, 70), true},
+		// Shown turned anticlockwise: the left half ends up at the bottom
+		{8, 40, 80, image.Pt(20, 10), image.Pt(20, 70), false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "photo.jpg")
+		if err := os.WriteFile(path, withOrientation(buf.Bytes(), tt.orientation), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		thumb, err := loadThumbnail(path, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if thumb.Bounds().Dx() != tt.width || thumb.Bounds().Dy() != tt.height {
+			t.Errorf("orientation %d: thumbnail is %v, want %dx%d", tt.orientation, thumb.Bounds(), tt.width, tt.height)
+			continue
+		}
+		first, second := thumb.NRGBAAt(tt.first.X, tt.first.Y), thumb.NRGBAAt(tt.second.X, tt.second.Y)
+		if tt.firstRed != isRed(first) || tt.firstRed != isBlue(second) {
+			t.Errorf("orientation %d: pixels %v and %v are in the wrong place", tt.orientation, first, second)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScriptTimeout = 30 * time.Second
+	// maxCapturedOutput caps the output kept per script
+	maxCapturedOutput = 64 << 10
+)
+
+// Step kinds of an entry, in the order they run
+const (
+	stepOsc        = "osc"
+	stepOscBundle  = "osc_bundle"
+	stepScript     = "script"
+	stepScriptPath = "script_path"
+)
+
+// runOptions controls how the actions of an entry are executed. Dir is the
+// working directory of scripts and the base of relative script paths, Index
+// the 0-based position of the entry in its media config. OnStep, if set, is
+// called as each step finishes. Clients, if set, are shared with other runs;
+// otherwise the entry gets its own for the run.
+type runOptions struct {
+	OnStep  func(stepResult)
+	Clients *oscClients
+	Dir     string
+	Timeout time.Duration
+	Index   int
+}
+
+// stepResult is the outcome of one step. ExitCode is -1 when a script could
+// not be started or was killed.
+type stepResult struct {
+	Started  time.Time `json:"started"`
+	Kind     string    `json:"kind"`
+	Action   string    `json:"action"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Delay    int       `json:"delay_ms"`
+	Duration int64     `json:"duration_ms"`
+	ExitCode int       `json:"exit_code"`
+}
+
+// runResult is the outcome of running all the steps of an entry
+type runResult struct {
+	Title    string       `json:"title"`
+	Steps    []stepResult `json:"steps"`
+	Index    int          `json:"index"`
+	Duration int64        `json:"duration_ms"`
+	OK       bool         `json:"ok"`
+}
+
+// runEntry executes the actions of an entry the way the deck does:
+//
+//   - the steps are the OSC commands, then Scripts, then ScriptPaths, in order
+//   - Delays[i] is the pause in milliseconds before step i
+//   - every step runs even when an earlier one failed
+//
+// With Bundle set, all OSC commands go out in one step as bundles, their
+// delays becoming timetag offsets, and the scripts follow.
+func runEntry(ctx context.Context, entry MediaEntry, opts runOptions) runResult {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultScriptTimeout
+	}
+
+	result := runResult{Title: entry.Title, Index: opts.Index + 1, OK: true}
+	start := time.Now()
+
+	clients := opts.Clients
+	if clients == nil {
+		clients = newOscClients()
+		defer clients.close()
+	}
+
+	record := func(step stepResult) {
+		step.Duration = time.Since(step.Started).Milliseconds()
+		if step.Error != "" {
+			result.OK = false
+		}
+		result.Steps = append(result.Steps, step)
+		if opts.OnStep != nil {
+			opts.OnStep(step)
+		}
+	}
+
+	step := 0
+	if entry.Bundle && len(entry.OscCommands) > 0 {
+		res := stepResult{Kind: stepOscBundle, Action: describeEntryOsc(entry), Started: time.Now()}
+		if err := sendEntryBundles(entry, clients); err != nil {
+			res.Error = err.Error()
+		}
+		record(res)
+		step = len(entry.OscCommands)
+	} else {
+		for _, cmd := range entry.OscCommands {
+			res := stepResult{Kind: stepOsc, Action: fmt.Sprintf("%s -> %s", cmd.OscPath, oscTarget(cmd))}
+			if res.Delay = entryDelay(entry, step); !sleepContext(ctx, res.Delay) {
+				return cancelled(result, start)
+			}
+			res.Started = time.Now()
+			if err := sendOscCommand(clients, cmd); err != nil {
+				res.Error = err.Error()
+			}
+			record(res)
+			step++
+		}
+	}
+
+	env := entryEnvironment(entry, opts.Index)
+	scripts := make([]stepResult, 0, len(entry.Scripts)+len(entry.ScriptPaths))
+	for _, script := range entry.Scripts {
+		scripts = append(scripts, stepResult{Kind: stepScript, Action: script})
+	}
+	for _, path := range entry.ScriptPaths {
+		scripts = append(scripts, stepResult{Kind: stepScriptPath, Action: path})
+	}
+
+	for _, res := range scripts {
+		if res.Delay = entryDelay(entry, step); !sleepContext(ctx, res.Delay) {
+			return cancelled(result, start)
+		}
+		res.Started = time.Now()
+		runScript(ctx, &res, opts, env)
+		record(res)
+		step++
+	}
+
+	result.Duration = time.Since(start).Milliseconds()
+	return result
+}
+
+// err joins the errors of the failed steps
+func (r runResult) err() error {
+	var errs []error
+	for _, step := range r.Steps {
+		if step.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", step.Action, step.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func cancelled(result runResult, start time.Time) runResult {
+	result.OK = false
+	result.Duration = time.Since(start).Milliseconds()
+	return result
+}
+
+// sleepContext waits for a delay in milliseconds and reports whether the
+// context is still live afterwards
+func sleepContext(ctx context.Context, delay int) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(time.Duration(delay) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// entryEnvironment describes the entry to its scripts
+func entryEnvironment(entry MediaEntry, index int) []string {
+	var address string
+	if len(entry.OscCommands) > 0 {
+		address = entry.OscCommands[0].OscPath
+	}
+	return append(os.Environ(),
+		"SD_TITLE="+entry.Title,
+		"SD_FULL_PATH="+entry.FullPath,
+		"SD_INDEX="+strconv.Itoa(index+1),
+		"SD_OSC_ADDRESS="+address,
+	)
+}
+
+// runScript runs an inline script through the shell, or a script file with
+// the interpreter its extension asks for, capturing stdout and stderr
+func runScript(ctx context.Context, res *stepResult, opts runOptions, env []string) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if res.Kind == stepScript {
+		cmd = shellCommand(ctx, res.Action)
+	} else {
+		// A bare name would be looked up in PATH, so join it to the
+		// absolute folder of the config
+		path := res.Action
+		if !filepath.IsAbs(path) {
+			dir, err := filepath.Abs(opts.Dir)
+			if err != nil {
+				res.Error = fmt.Sprintf("resolving %s: %v", path, err)
+				return
+			}
+			path = filepath.Join(dir, path)
+		}
+		cmd = scriptCommand(ctx, path)
+	}
+	cmd.Dir = opts.Dir
+	cmd.Env = env
+	// Do not wait forever for children that keep the output open
+	cmd.WaitDelay = time.Second
+
+	var output cappedBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	res.Output = output.String()
+	res.ExitCode = cmd.ProcessState.ExitCode()
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.Error = fmt.Sprintf("timed out after %s", opts.Timeout)
+	case err != nil:
+		res.Error = err.Error()
+	}
+}
+
+func shellCommand(ctx context.Context, script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", script)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", script)
+}
+
+// scriptCommand picks the interpreter of a script file by its extension and
+// runs anything else directly
+func scriptCommand(ctx context.Context, path string) *exec.Cmd {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ps1":
+		return exec.CommandContext(ctx, "powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-File", path)
+	case ".bat", ".cmd":
+		return exec.CommandContext(ctx, "cmd", "/C", path)
+	case ".sh":
+		return exec.CommandContext(ctx, "sh", path)
+	}
+	return exec.CommandContext(ctx, path)
+}
+
+// cappedBuffer keeps the first maxCapturedOutput bytes written to it and
+// drops the rest, so chatty scripts cannot exhaust memory
+type cappedBuffer struct {
+	buf       []byte
+	mu        sync.Mutex
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	room := maxCapturedOutput - len(b.buf)
+	if len(p) > room {
+		b.truncated = true
+		b.buf = append(b.buf, p[:max(room, 0)]...)
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return string(b.buf) + "\n[output truncated]"
+	}
+	return string(b.buf)
+}
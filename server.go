@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+const defaultServeAddr = "127.0.0.1:8765"
+
+// triggerHeader lets webhook senders that cannot send a JSON content type
+// trigger entries. Browsers only send it to other sites after a CORS
+// preflight, which the server never answers.
+const triggerHeader = "X-Streamdeck-Trigger"
+
+// servedConfig is one media config exposed by the server, addressed by ID
+type servedConfig struct {
+	Media *MediaConfig
+	ID    string
+	Path  string
+	Dir   string
+}
+
+// mediaServer exposes prepared entries over HTTP:
+//
+//	GET  /api/configs
+//	GET  /api/configs/{id}/entries
+//	GET  /api/configs/{id}/entries/{entry}
+//	GET  /api/configs/{id}/entries/{entry}/image
+//	GET  /api/configs/{id}/entries/{entry}/image_pressed
+//	POST /api/configs/{id}/entries/{entry}/trigger
+//	GET  /api/events (WebSocket)
+//	GET  /gallery/{id}/
+//
+// where {entry} is a 1-based index or a title.
+type mediaServer struct {
+	events         *eventBus
+	clients        *oscClients
+	configs        []*servedConfig
+	devices        []config.DeviceProfile
+	allowedOrigins []string
+	addr           string
+	timeout        time.Duration
+}
+
+// configInfo summarises a served config
+type configInfo struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Entries int    `json:"entries"`
+}
+
+// entryInfo is an entry with its position and the URLs of its images
+type entryInfo struct {
+	MediaEntry
+	ImageURL        string `json:"image_url,omitempty"`
+	ImagePressedURL string `json:"image_pressed_url,omitempty"`
+	Index           int    `json:"index"`
+}
+
+// serveCmd loads the given media configs and serves them until interrupted
+func serveCmd(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", defaultServeAddr, "address to listen on")
+	timeout := fs.Duration("timeout", defaultScriptTimeout, "time limit for each script")
+	allowOrigin := fs.String("allow-origin", "", "comma-separated origins besides this server and localhost that may open the event stream, null for local files or * for any")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cli-prepare-for-streamdeck serve [flags] <config>...")
+		fmt.Fprintln(fs.Output(), "Each <config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	server := &mediaServer{addr: *addr, timeout: *timeout, events: newEventBus(), clients: newOscClients(), devices: cfg.Devices()}
+	for _, origin := range strings.Split(*allowOrigin, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			server.allowedOrigins = append(server.allowedOrigins, origin)
+		}
+	}
+	for _, path := range fs.Args() {
+		if err := server.add(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", path, err)
+			return 1
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(*addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			fmt.Printf("Warning: listening on %s lets other machines trigger entries\n", *addr)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           server.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.events.close()
+		_ = httpServer.Shutdown(shutdown)
+		server.clients.close()
+	}()
+
+	for _, cfg := range server.configs {
+		fmt.Printf("Serving %s (%d entries) as /api/configs/%s\n", cfg.Path, len(cfg.Media.Files), cfg.ID)
+	}
+	fmt.Printf("Listening on http://%s\n", *addr)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error running server: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// add loads a media config and gives it an ID from its folder name, made
+// unique with a number when several folders share a name
+func (s *mediaServer) add(path string) error {
+	media, dir, err := loadMediaConfig(path)
+	if err != nil {
+		return err
+	}
+
+	base := strings.ToLower(filepath.Base(dir))
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+		base = strings.ToLower(filepath.Base(abs))
+	}
+	id := base
+	for n := 2; s.find(id) != nil; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	s.configs = append(s.configs, &servedConfig{
+		Media: media,
+		ID:    id,
+		Path:  filepath.Join(dir, mediaConfigName),
+		Dir:   dir,
+	})
+	return nil
+}
+
+func (s *mediaServer) find(id string) *servedConfig {
+	for _, cfg := range s.configs {
+		if cfg.ID == id {
+			return cfg
+		}
+	}
+	return nil
+}
+
+func (s *mediaServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/configs", s.handleConfigs)
+	mux.HandleFunc("/api/configs/", s.handleConfig)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/gallery/", s.handleGallery)
+	return mux
+}
+
+func (s *mediaServer) handleConfigs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	infos := make([]configInfo, 0, len(s.configs))
+	for _, cfg := range s.configs {
+		infos = append(infos, configInfo{ID: cfg.ID, Path: cfg.Path, Entries: len(cfg.Media.Files)})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleConfig routes the requests below /api/configs/{id}/
+func (s *mediaServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/configs/"), "/"), "/")
+
+	cfg := s.find(parts[0])
+	if cfg == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no config %q", parts[0]))
+		return
+	}
+	if len(parts) < 2 || parts[1] != "entries" || len(parts) > 4 {
+		writeError(w, http.StatusNotFound, "unknown path")
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		entries := make([]entryInfo, 0, len(cfg.Media.Files))
+		for i := range cfg.Media.Files {
+			entries = append(entries, cfg.entryInfo(i))
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	index, err := findEntry(cfg.Media, parts[2])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	action := ""
+	if len(parts) == 4 {
+		action = parts[3]
+	}
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		writeJSON(w, http.StatusOK, cfg.entryInfo(index))
+
+	case "image", "image_pressed":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		name := cfg.Media.Files[index].Image
+		if action == "image_pressed" {
+			name = cfg.Media.Files[index].ImagePressed
+		}
+		if name == "" {
+			writeError(w, http.StatusNotFound, "the entry has no "+strings.ReplaceAll(action, "_", " "))
+			return
+		}
+		// Images are written next to the config, never elsewhere
+		http.ServeFile(w, r, filepath.Join(cfg.Dir, filepath.Base(name)))
+
+	case "trigger":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if status, err := s.checkTrigger(r); err != nil {
+			writeError(w, status, err.Error())
+			return
+		}
+		// Keep running when the caller hangs up, as a key press would
+		ctx := context.WithoutCancel(r.Context())
+		writeJSON(w, http.StatusOK, s.trigger(ctx, cfg, index))
+
+	default:
+		writeError(w, http.StatusNotFound, "unknown path")
+	}
+}
+
+// checkTrigger rejects trigger requests that a web page on another site
+// could have sent: plain form posts, requests to a domain rebound to the
+// server's address and requests from a foreign origin
+func (s *mediaServer) checkTrigger(r *http.Request) (int, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" && r.Header.Get(triggerHeader) == "" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("send Content-Type: application/json or a %s header", triggerHeader)
+	}
+	if !s.servesHost(r.Host) {
+		return http.StatusForbidden, fmt.Errorf("host %q is not this server", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) {
+		return http.StatusForbidden, fmt.Errorf("origin %q is not this server", origin)
+	}
+	return 0, nil
+}
+
+// servesHost reports whether a Host header names the server: its port with
+// the listening host, localhost or an IP address. Any other name may be a
+// domain an attacker pointed at the server.
+func (s *mediaServer) servesHost(hostport string) bool {
+	boundHost, boundPort, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, "80"
+	}
+	if port != boundPort {
+		return false
+	}
+	return strings.EqualFold(host, boundHost) || strings.EqualFold(host, "localhost") ||
+		net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+// sameOrigin reports whether an Origin header names the host a request was
+// sent to
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, host)
+}
+
+// handleGallery renders the preview gallery of a config at /gallery/{id}/,
+// with the images it shows next to it. ?device= picks the device profile,
+// by default the one the pages are laid out for.
+func (s *mediaServer) handleGallery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/gallery/"), "/")
+	cfg := s.find(id)
+	if cfg == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no config %q", id))
+		return
+	}
+
+	if name == "" {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Relative image links need the trailing slash
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		device, err := mediaDeviceProfile(s.devices, cfg.Media, r.URL.Query().Get("device"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = writeGallery(w, buildGallery(cfg.Media, cfg.Dir, device, relativeURL))
+		return
+	}
+
+	// Only the images of the entries are served, not the whole folder
+	for _, entry := range cfg.Media.Files {
+		if name == entry.Image || name == entry.ImagePressed {
+			http.ServeFile(w, r, filepath.Join(cfg.Dir, filepath.Base(name)))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "unknown image")
+}
+
+// trigger runs the actions of an entry, publishing an event when it starts,
+// after every step and when it is done
+func (s *mediaServer) trigger(ctx context.Context, cfg *servedConfig, index int) runResult {
+	entry := cfg.Media.Files[index]
+	base := event{Config: cfg.ID, Index: index + 1, Title: entry.Title, FullPath: entry.FullPath}
+
+	started := base
+	started.Type = eventEntryTriggered
+	started.OK = true
+	s.events.publish(started)
+
+	result := runEntry(ctx, entry, runOptions{
+		Clients: s.clients,
+		Dir:     cfg.Dir,
+		Timeout: s.timeout,
+		Index:   index,
+		OnStep: func(step stepResult) {
+			s.events.publish(stepEvent(base, step))
+		},
+	})
+
+	finished := base
+	finished.Type = eventEntryFinished
+	finished.Duration = result.Duration
+	finished.OK = result.OK
+	s.events.publish(finished)
+	return result
+}
+
+func (cfg *servedConfig) entryInfo(index int) entryInfo {
+	entry := cfg.Media.Files[index]
+	info := entryInfo{MediaEntry: entry, Index: index + 1}
+	base := fmt.Sprintf("/api/configs/%s/entries/%s/", cfg.ID, strconv.Itoa(index+1))
+	if entry.Image != "" {
+		info.ImageURL = base + "image"
+	}
+	if entry.ImagePressed != "" {
+		info.ImagePressedURL = base + "image_pressed"
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
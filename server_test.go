@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves one config with an entry that has no actions, so
+// triggering it runs nothing
+func newTestServer(addr string) *mediaServer {
+	return &mediaServer{
+		addr:    addr,
+		events:  newEventBus(),
+		clients: newOscClients(),
+		configs: []*servedConfig{{
+			Media: &MediaConfig{Files: []MediaEntry{{Title: "Intro"}}},
+			ID:    "show",
+			Dir:   ".",
+		}},
+	}
+}
+
+func TestTriggerRequestChecks(t *testing.T) {
+	tests := map[string]struct {
+		addr    string
+		host    string
+		headers map[string]string
+		status  int
+	}{
+		"json":              {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "application/json"}, status: http.StatusOK},
+		"json charset":      {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "application/json; charset=utf-8"}, status: http.StatusOK},
+		"custom header":     {host: "127.0.0.1:8765", headers: map[string]string{triggerHeader: "1"}, status: http.StatusOK},
+		"localhost":         {host: "localhost:8765", headers: map[string]string{triggerHeader: "1"}, status: http.StatusOK},
+		"lan address":       {addr: "0.0.0.0:8765", host: "10.0.0.5:8765", headers: map[string]string{triggerHeader: "1"}, status: http.StatusOK},
+		"bound name":        {addr: "studio.local:8765", host: "studio.local:8765", headers: map[string]string{triggerHeader: "1"}, status: http.StatusOK},
+		"same origin":       {host: "127.0.0.1:8765", headers: map[string]string{triggerHeader: "1", "Origin": "http://127.0.0.1:8765"}, status: http.StatusOK},
+		"form post":         {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, status: http.StatusUnsupportedMediaType},
+		"text post":         {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "text/plain"}, status: http.StatusUnsupportedMediaType},
+		"rebound domain":    {host: "attacker.example:8765", headers: map[string]string{triggerHeader: "1"}, status: http.StatusForbidden},
+		"other port":        {host: "127.0.0.1:9000", headers: map[string]string{triggerHeader: "1"}, status: http.StatusForbidden},
+		"foreign origin":    {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "application/json", "Origin": "https://attacker.example"}, status: http.StatusForbidden},
+		"file origin":       {host: "127.0.0.1:8765", headers: map[string]string{"Content-Type": "application/json", "Origin": "null"}, status: http.StatusForbidden},
+		"other port origin": {host: "127.0.0.1:8765", headers: map[string]string{triggerHeader: "1", "Origin": "http://127.0.0.1:3000"}, status: http.StatusForbidden},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			addr := tt.addr
+			if addr == "" {
+				addr = defaultServeAddr
+			}
+			s := newTestServer(addr)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/configs/show/entries/1/trigger", strings.NewReader("{}"))
+			req.Host = tt.host
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
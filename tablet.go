@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+// tabletPadding is the gap in pixels around each button of a tablet layout
+const tabletPadding = 4
+
+// tabletButton is an entry placed on a page of a tablet layout. The frame
+// is in pixels from the top left corner of the page.
+type tabletButton struct {
+	Entry  MediaEntry
+	Index  int
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// tabletData is what a tablet layout is written from. ImageURL turns an
+// image name from the config into the path the layout loads it from, and
+// Dir is the folder of the config.
+type tabletData struct {
+	ImageURL func(name string) string
+	Name     string
+	Dir      string
+	Pages    [][]tabletButton
+	Layout   config.TabletLayout
+}
+
+// tabletExporter writes a layout for a tablet OSC app in the grid of layout
+type tabletExporter struct {
+	write     func(w io.Writer, data tabletData) error
+	name      string
+	command   string
+	extension string
+	app       string
+	layout    config.TabletLayout
+}
+
+// run parses the flags of an export command and writes the layout
+func (e tabletExporter) run(args []string) int {
+	cfg, err := loadConfigIfPresent()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	layout := cfg.Layout()
+
+	fs := flag.NewFlagSet(e.command, flag.ContinueOnError)
+	fs.IntVar(&layout.Rows, "rows", layout.Rows, "rows of buttons on a page")
+	fs.IntVar(&layout.Cols, "cols", layout.Cols, "columns of buttons on a page")
+	name := fs.String("name", "", "layout name (default: the folder name)")
+	out := fs.String("out", "", "file to write (default: <name>"+e.extension+" next to the config)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cli-prepare-for-streamdeck %s [flags] <config>\n", e.command)
+		fmt.Fprintln(fs.Output(), "<config> is a media_config.json or its folder.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := layout.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	media, dir, err := loadMediaConfig(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading media config: %v\n", err)
+		return 1
+	}
+
+	if *name == "" {
+		*name = filepath.Base(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			*name = filepath.Base(abs)
+		}
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(dir, *name+e.extension)
+	}
+	// Image links are relative to wherever the layout is written
+	base, err := filepath.Rel(filepath.Dir(path), dir)
+	if err != nil {
+		base = dir
+	}
+	imageURL := func(name string) string {
+		return relativeURL(filepath.Join(base, name))
+	}
+
+	data := tabletData{
+		ImageURL: imageURL,
+		Name:     *name,
+		Dir:      dir,
+		Pages:    layoutTablet(media, layout),
+		Layout:   layout,
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s layout: %v\n", e.app, err)
+		return 1
+	}
+	defer file.Close()
+	if err := e.write(file, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s layout: %v\n", e.app, err)
+		return 1
+	}
+
+	fmt.Printf("%s layout with %d buttons on %d page(s) saved to %s\n", e.app, len(media.Files), len(data.Pages), path)
+	return 0
+}
+
+// layoutTablet places the entries row by row on pages of the layout's grid
+func layoutTablet(media *MediaConfig, layout config.TabletLayout) [][]tabletButton {
+	cellWidth := layout.Width / layout.Cols
+	cellHeight := layout.Height / layout.Rows
+
+	pages := make([][]tabletButton, max((len(media.Files)+layout.Buttons()-1)/layout.Buttons(), 1))
+	for i, entry := range media.Files {
+		slot := i % layout.Buttons()
+		p := i / layout.Buttons()
+		pages[p] = append(pages[p], tabletButton{
+			Entry:  entry,
+			Index:  i,
+			X:      slot%layout.Cols*cellWidth + tabletPadding,
+			Y:      slot/layout.Cols*cellHeight + tabletPadding,
+			Width:  max(cellWidth-2*tabletPadding, 1),
+			Height: max(cellHeight-2*tabletPadding, 1),
+		})
+	}
+	return pages
+}
+
+// tabletWarnings reports what of an entry a tablet layout cannot do
+func tabletWarnings(entry MediaEntry, app string) {
+	if len(entry.Scripts) > 0 || len(entry.ScriptPaths) > 0 {
+		fmt.Printf("Warning: %s runs scripts, which %s buttons cannot\n", entry.Title, app)
+	}
+}
+
+func (e tabletExporter) Name() string      { return e.name }
+func (e tabletExporter) Extension() string { return e.extension }
+
+func (e tabletExporter) Export(media MediaConfig, outDir string) (string, error) {
+	if err := e.layout.Validate(); err != nil {
+		return "", err
+	}
+	data := tabletData{
+		ImageURL: relativeURL,
+		Name:     exportName(outDir),
+		Dir:      outDir,
+		Pages:    layoutTablet(&media, e.layout),
+		Layout:   e.layout,
+	}
+	return exportFile(filepath.Join(outDir, data.Name+e.extension), func(w io.Writer) error {
+		return e.write(w, data)
+	})
+}
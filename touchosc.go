@@ -0,0 +1,315 @@
+package main
+
+import (
+	"compress/zlib"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+const (
+	// touchOSCConnections is how many connections TouchOSC can send to
+	touchOSCConnections = 10
+	// touchOSCTabBar is the height of the page tabs when there are several pages
+	touchOSCTabBar = 40
+)
+
+var touchOSCExporter = tabletExporter{
+	write:     writeTouchOSCLayout,
+	name:      "touchosc",
+	command:   "export-touchosc",
+	extension: ".tosc",
+	app:       "TouchOSC",
+}
+
+// toscNode is a control of a TouchOSC layout
+type toscNode struct {
+	XMLName    xml.Name         `xml:"node"`
+	ID         string           `xml:"ID,attr"`
+	Type       string           `xml:"type,attr"`
+	Properties []toscProperty   `xml:"properties>property"`
+	Values     []toscValue      `xml:"values>value"`
+	Messages   []toscOscMessage `xml:"messages>osc"`
+	Children   []toscNode       `xml:"children>node"`
+}
+
+// toscProperty is a property of a control. Its value is plain text, or
+// elements for frames and colors, so it is kept as inner XML.
+type toscProperty struct {
+	Type  string       `xml:"type,attr"`
+	Key   string       `xml:"key"`
+	Value toscInnerXML `xml:"value"`
+}
+
+type toscInnerXML struct {
+	XML string `xml:",innerxml"`
+}
+
+// toscValue is a value of a control, such as the x of a button or the text
+// of a label
+type toscValue struct {
+	Key                  string `xml:"key"`
+	Default              string `xml:"default"`
+	Locked               int    `xml:"locked"`
+	LockedDefaultCurrent int    `xml:"lockedDefaultCurrent"`
+	DefaultPull          int    `xml:"defaultPull"`
+}
+
+// toscOscMessage is an OSC message a control sends when its trigger fires
+type toscOscMessage struct {
+	Connections string        `xml:"connections"`
+	Triggers    []toscTrigger `xml:"triggers>trigger"`
+	Path        []toscPartial `xml:"path>partial"`
+	Arguments   []toscPartial `xml:"arguments>partial"`
+	Enabled     int           `xml:"enabled"`
+	Send        int           `xml:"send"`
+	Receive     int           `xml:"receive"`
+	Feedback    int           `xml:"feedback"`
+}
+
+type toscTrigger struct {
+	Var       string `xml:"var"`
+	Condition string `xml:"condition"`
+}
+
+// toscPartial is a constant part of a message path or an argument
+type toscPartial struct {
+	Type       string `xml:"type"`
+	Conversion string `xml:"conversion"`
+	Value      string `xml:"value"`
+	ScaleMin   int    `xml:"scaleMin"`
+	ScaleMax   int    `xml:"scaleMax"`
+}
+
+// writeTouchOSCLayout writes a zlib compressed TouchOSC layout, with a pager
+// when there are several pages. TouchOSC layouts cannot hold pictures, so a
+// button takes the average color of its image instead, with its title on a
+// label across its lower edge. The targets of the commands are mapped to the numbered
+// connections of TouchOSC, which are set up on the tablet.
+func writeTouchOSCLayout(w io.Writer, data tabletData) error {
+	connections := map[config.OscTarget]int{}
+	var targets []config.OscTarget
+
+	// Pages sit below the tabs of the pager
+	top := 0
+	if len(data.Pages) > 1 {
+		top = touchOSCTabBar
+	}
+
+	pageNodes := make([]toscNode, 0, len(data.Pages))
+	for p, page := range data.Pages {
+		group := toscNode{ID: newProfileUUID(), Type: "GROUP"}
+		for _, button := range page {
+			entry := button.Entry
+			tabletWarnings(entry, "TouchOSC")
+
+			var messages []toscOscMessage
+			for i, cmd := range entry.OscCommands {
+				if entryDelay(entry, i) > 0 {
+					fmt.Printf("Warning: %s delays %s, TouchOSC sends all messages of a button at once\n", entry.Title, cmd.OscPath)
+				}
+				// Commands that cannot be sent take no connection
+				message, err := touchOSCMessage(cmd)
+				if err != nil {
+					fmt.Printf("Warning: %s: %v\n", entry.Title, err)
+					continue
+				}
+
+				target := oscTarget(cmd)
+				connection, ok := connections[target]
+				if !ok {
+					if len(targets) == touchOSCConnections {
+						fmt.Printf("Warning: %s sends to %s, but TouchOSC has only %d connections\n", entry.Title, target, touchOSCConnections)
+						continue
+					}
+					targets = append(targets, target)
+					connection = len(targets)
+					connections[target] = connection
+				}
+				mask := []byte(strings.Repeat("0", touchOSCConnections))
+				mask[connection-1] = '1'
+				message.Connections = string(mask)
+				messages = append(messages, message)
+			}
+
+			background := color.RGBA{R: 80, G: 80, B: 80, A: 255}
+			if entry.Image != "" {
+				if average, err := averageImageColor(filepath.Join(data.Dir, entry.Image)); err == nil {
+					background = average
+				} else {
+					fmt.Printf("Warning: %s has no button color: %v\n", entry.Title, err)
+				}
+			}
+
+			name := fmt.Sprintf("key_%d", button.Index+1)
+			group.Children = append(group.Children,
+				toscNode{
+					ID:   newProfileUUID(),
+					Type: "BUTTON",
+					Properties: []toscProperty{
+						toscString("name", name),
+						toscFrame(button.X, button.Y, button.Width, button.Height),
+						toscColor("color", background),
+						toscInt("buttonType", 0),
+					},
+					Values:   []toscValue{{Key: "x", Default: "0"}, {Key: "touch", Default: "false"}},
+					Messages: messages,
+				},
+				toscNode{
+					ID:   newProfileUUID(),
+					Type: "LABEL",
+					Properties: []toscProperty{
+						toscString("name", name+"_title"),
+						toscFrame(button.X, button.Y+button.Height*3/4, button.Width, button.Height/4),
+						toscColor("textColor", color.RGBA{R: 255, G: 255, B: 255, A: 255}),
+						toscBool("interactive", false),
+						toscBool("background", false),
+					},
+					Values: []toscValue{{Key: "text", Default: entry.Title}},
+				})
+		}
+
+		group.Properties = []toscProperty{
+			toscString("name", fmt.Sprintf("page_%d", p+1)),
+			toscString("tabLabel", fmt.Sprintf("Page %d", p+1)),
+			toscFrame(0, top, data.Layout.Width, data.Layout.Height),
+		}
+		pageNodes = append(pageNodes, group)
+	}
+
+	root := toscNode{
+		ID:   newProfileUUID(),
+		Type: "GROUP",
+		Properties: []toscProperty{
+			toscString("name", data.Name),
+			toscFrame(0, 0, data.Layout.Width, data.Layout.Height+top),
+		},
+	}
+	if len(pageNodes) == 1 {
+		root.Children = pageNodes[0].Children
+	} else {
+		root.Children = []toscNode{{
+			ID:   newProfileUUID(),
+			Type: "PAGER",
+			Properties: []toscProperty{
+				toscString("name", "pages"),
+				toscFrame(0, 0, data.Layout.Width, data.Layout.Height+top),
+				toscInt("tabbarSize", touchOSCTabBar),
+			},
+			Values:   []toscValue{{Key: "page", Default: "0"}},
+			Children: pageNodes,
+		}}
+	}
+
+	for i, target := range targets {
+		fmt.Printf("Set up TouchOSC connection %d to send OSC to %s\n", i+1, target)
+	}
+
+	z := zlib.NewWriter(w)
+	if _, err := io.WriteString(z, xml.Header+`<lexml version="3">`); err != nil {
+		return err
+	}
+	if err := xml.NewEncoder(z).Encode(root); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(z, "</lexml>\n"); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// touchOSCMessage sends a command with constant arguments when the button
+// is pressed. The caller picks its connections.
+func touchOSCMessage(cmd OscCommand) (toscOscMessage, error) {
+	msg, err := oscMessage(cmd)
+	if err != nil {
+		return toscOscMessage{}, err
+	}
+
+	message := toscOscMessage{
+		Enabled:  1,
+		Send:     1,
+		Triggers: []toscTrigger{{Var: "x", Condition: "RISE"}},
+		Path:     []toscPartial{{Type: "CONSTANT", Conversion: "STRING", Value: cmd.OscPath, ScaleMax: 1}},
+	}
+	for _, arg := range msg.Arguments {
+		partial := toscPartial{Type: "CONSTANT", ScaleMax: 1}
+		switch v := arg.(type) {
+		case int32:
+			partial.Conversion, partial.Value = "INTEGER", strconv.Itoa(int(v))
+		case float32:
+			partial.Conversion, partial.Value = "FLOAT", strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case string:
+			partial.Conversion, partial.Value = "STRING", v
+		case bool:
+			partial.Conversion, partial.Value = "BOOLEAN", strconv.FormatBool(v)
+		default:
+			return toscOscMessage{}, fmt.Errorf("%s: TouchOSC cannot send the argument %v", cmd.OscPath, arg)
+		}
+		message.Arguments = append(message.Arguments, partial)
+	}
+	return message, nil
+}
+
+// averageImageColor is the mean color of an image, taken from a small copy
+func averageImageColor(path string) (color.RGBA, error) {
+	img, err := loadThumbnail(path, 16)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	var r, g, b, n int
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		r += int(img.Pix[i])
+		g += int(img.Pix[i+1])
+		b += int(img.Pix[i+2])
+		n++
+	}
+	if n == 0 {
+		return color.RGBA{}, fmt.Errorf("%s is empty", filepath.Base(path))
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}, nil
+}
+
+func toscString(key, value string) toscProperty {
+	return toscProperty{Type: "s", Key: key, Value: toscInnerXML{XML: xmlEscape(value)}}
+}
+
+func toscInt(key string, value int) toscProperty {
+	return toscProperty{Type: "i", Key: key, Value: toscInnerXML{XML: strconv.Itoa(value)}}
+}
+
+func toscBool(key string, value bool) toscProperty {
+	v := "0"
+	if value {
+		v = "1"
+	}
+	return toscProperty{Type: "b", Key: key, Value: toscInnerXML{XML: v}}
+}
+
+func toscFrame(x, y, w, h int) toscProperty {
+	return toscProperty{Type: "r", Key: "frame", Value: toscInnerXML{
+		XML: fmt.Sprintf("<x>%d</x><y>%d</y><w>%d</w><h>%d</h>", x, y, w, h),
+	}}
+}
+
+// toscColor writes a color with components from 0 to 1
+func toscColor(key string, c color.RGBA) toscProperty {
+	component := func(v uint8) string {
+		return strconv.FormatFloat(float64(v)/255, 'f', 3, 64)
+	}
+	return toscProperty{Type: "c", Key: key, Value: toscInnerXML{
+		XML: fmt.Sprintf("<r>%s</r><g>%s</g><b>%s</b><a>%s</a>", component(c.R), component(c.G), component(c.B), component(c.A)),
+	}}
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
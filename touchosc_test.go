@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/buffos/cli-prepare-for-streamdeck/config"
+)
+
+var toscConnectionsRe = regexp.MustCompile(`<connections>([01]+)</connections>`)
+
+func TestTouchOSCSkipsUnusedConnections(t *testing.T) {
+	media := &MediaConfig{Files: []MediaEntry{{
+		Title: "Intro",
+		OscCommands: []OscCommand{
+			// Cannot be sent, so its target must not take a connection
+			{OscPath: "/clip/1", OscTypeTags: "i", OscValue: []any{"one"}, OscHost: "10.0.0.9", OscPort: 9000},
+			{OscPath: "/clip/1/go", OscHost: "10.0.0.5", OscPort: 7000},
+		},
+	}}}
+	data := tabletData{
+		ImageURL: relativeURL,
+		Name:     "Show",
+		Dir:      t.TempDir(),
+		Pages:    layoutTablet(media, config.DefaultTabletLayout),
+		Layout:   config.DefaultTabletLayout,
+	}
+
+	var buf bytes.Buffer
+	if err := writeTouchOSCLayout(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zlib.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var masks []string
+	for _, match := range toscConnectionsRe.FindAllSubmatch(layout, -1) {
+		masks = append(masks, string(match[1]))
+	}
+	if want := []string{"1000000000"}; !slices.Equal(masks, want) {
+		t.Errorf("messages use connections %q, want %q", masks, want)
+	}
+}